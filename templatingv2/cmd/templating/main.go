@@ -0,0 +1,341 @@
+// Command templating inspects, checks, renders and serves a template tree without writing Go,
+// e.g. in CI or for frontend development. The views are read from disk, see the -routes,
+// -layouts and -assets flags of every subcommand.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Simon-Martens/misc_tests/templating"
+	"github.com/Simon-Martens/misc_tests/templating/funcs"
+)
+
+const USAGE = `usage: templating <command> [flags] [args]
+
+commands:
+  routes                     list all routes with their layout and template files
+  render <path> [data.json]  render the page of a path to stdout, with data from a JSON file
+  check                      parse and render all layouts and routes and report every error
+  serve                      serve the routes, with -dev reloading changed templates
+  export <dir>               render all routes that need no data into a directory
+
+Run templating <command> -h for the flags of a command.
+`
+
+const RELOAD_PATH = "/_reload"
+const LIVE_PATH = "/_live"
+const WATCH_INTERVAL = 500 * time.Millisecond
+
+var policies = map[string]templating.CollisionPolicy{
+	"allow":  templating.AllowCollisions,
+	"warn":   templating.WarnCollisions,
+	"forbid": templating.ForbidCollisions,
+}
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"routes": routes,
+	"render": render,
+	"check":  check,
+	"serve":  serve,
+	"export": export,
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, USAGE)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], USAGE)
+		os.Exit(2)
+	}
+
+	err := cmd(os.Args[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// INFO: config holds the flags shared by all commands
+type config struct {
+	flags   *flag.FlagSet
+	routes  string
+	layouts string
+	assets  string
+	prefix  string
+	layout  string
+	policy  templating.CollisionPolicy
+}
+
+func newConfig(name, args string) *config {
+	c := &config{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	c.flags.StringVar(&c.routes, "routes", "views/routes", "directory of the routes")
+	c.flags.StringVar(&c.layouts, "layouts", "views/layouts", "directory of the layouts")
+	c.flags.StringVar(&c.assets, "assets", "views/assets", "directory of the static assets")
+	c.flags.StringVar(&c.prefix, "prefix", "/assets/", "URL path the assets are served at")
+	c.flags.StringVar(&c.layout, "layout", templating.TEMPLATE_DEFAULT_LAYOUT, "layout of routes without a layout file")
+	c.policy = templating.WarnCollisions
+	c.flags.Func("collisions", "how to treat templates sharing a name: allow, `warn` or forbid", func(s string) error {
+		policy, ok := policies[s]
+		if !ok {
+			return fmt.Errorf("unknown collision policy %q", s)
+		}
+
+		c.policy = policy
+		return nil
+	})
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.flags.Output(), "usage: templating %s [flags] %s\n\nflags:\n", name, args)
+		c.flags.PrintDefaults()
+	}
+
+	return c
+}
+
+// INFO: handler builds the registries like the server does. Parse errors are returned
+// along with the handler, which serves the healthy templates.
+func (c *config) handler() (*templating.Handler, *templating.Assets, error) {
+	lr := templating.NewLayoutRegistry(os.DirFS(c.layouts))
+	tr := templating.NewTemplateRegistry(os.DirFS(c.routes))
+	lr.SetCollisionPolicy(c.policy)
+	tr.SetCollisionPolicy(c.policy)
+
+	assets := templating.NewAssets(c.prefix, os.DirFS(c.assets))
+	vite := templating.NewVite(assets)
+	// INFO: live components have no controllers without Go code, but their templates must parse
+	live := templating.NewLive(LIVE_PATH)
+
+	for _, f := range []template.FuncMap{funcs.Standard(), assets.Funcs(), vite.Funcs(), live.Funcs()} {
+		lr.RegisterFuncs(f)
+		tr.RegisterFuncs(f)
+	}
+
+	lerr := lr.Parse()
+	rerr := tr.Parse()
+
+	handler := templating.NewHandler(lr, tr)
+	handler.Layout = c.layout
+
+	return handler, assets, errors.Join(lerr, rerr)
+}
+
+func routes(args []string) error {
+	c := newConfig("routes", "")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+
+	handler, _, err := c.handler()
+	if err != nil {
+		log.Println(err)
+	}
+
+	for _, route := range handler.Routes.Routes() {
+		layout := handler.Routes.Layout(route)
+		if layout == "" {
+			layout = handler.Layout
+		}
+
+		fmt.Printf("%s\tlayout: %s", route, layout)
+		if handler.Routes.HasLoader(route) {
+			fmt.Print("\tloader")
+		}
+		if err, ok := handler.Routes.Broken()[route]; ok {
+			fmt.Printf("\tbroken: %v", err)
+		}
+		fmt.Println()
+
+		for _, s := range handler.Routes.Sources(route) {
+			fmt.Printf("\t%s\t%s\t%s\n", s.Context, s.Name, s.File)
+			for _, shadowed := range s.Shadows {
+				fmt.Printf("\t\t\tshadows %s\n", shadowed)
+			}
+		}
+	}
+
+	return nil
+}
+
+func render(args []string) error {
+	c := newConfig("render", "<path> [data.json]")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+
+	if c.flags.NArg() < 1 || c.flags.NArg() > 2 {
+		c.flags.Usage()
+		return flag.ErrHelp
+	}
+
+	var data any
+	if c.flags.NArg() == 2 {
+		file, err := os.ReadFile(c.flags.Arg(1))
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(file, &data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.flags.Arg(1), err)
+		}
+	}
+
+	// INFO: broken templates elsewhere in the tree do not keep us from rendering a healthy route
+	handler, _, err := c.handler()
+	if err != nil {
+		log.Println(err)
+	}
+
+	return handler.Render(os.Stdout, c.flags.Arg(0), data)
+}
+
+func check(args []string) error {
+	c := newConfig("check", "")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+
+	handler, _, err := c.handler()
+	errs := []error{err}
+	live := []string{}
+
+	for _, route := range handler.Routes.Routes() {
+		if _, ok := handler.Routes.Broken()[route]; ok {
+			continue
+		}
+
+		// INFO: layouts are only resolved on request, so we check that every selected layout exists
+		layout := handler.Routes.Layout(route)
+		if layout == "" {
+			layout = handler.Layout
+		}
+
+		if _, err := handler.Layouts.Get(layout); err != nil {
+			if handler.Layouts.Broken()[layout] == nil {
+				errs = append(errs, fmt.Errorf("%s: %w", route, err))
+			}
+			continue
+		}
+
+		// INFO: live components need the controllers of a server, so check can not render them, like render
+		uses, err := handler.UsesLive(route)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", route, err))
+			continue
+		}
+		if uses {
+			live = append(live, route)
+			continue
+		}
+
+		// INFO: execution errors, e.g. calls of undefined templates, are only found by rendering
+		err = handler.Render(io.Discard, route, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", route, err))
+		}
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d routes, %d layouts ok\n", len(handler.Routes.Routes())-len(live), len(handler.Layouts.Names()))
+	if len(live) > 0 {
+		fmt.Printf("%d routes with live components not rendered, they need a server: %s\n", len(live), strings.Join(live, ", "))
+	}
+
+	return nil
+}
+
+func serve(args []string) error {
+	c := newConfig("serve", "")
+	addr := c.flags.String("addr", "127.0.0.1:1323", "address to listen on")
+	dev := c.flags.Bool("dev", false, "watch the views for changes, reload the browser and show the debug page on errors")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+
+	handler, assets, err := c.handler()
+	if err != nil {
+		log.Println(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(assets.Prefix, assets)
+	mux.Handle("/", handler)
+
+	if *dev {
+		reloader := templating.NewReloader(RELOAD_PATH)
+		handler.Reloader = reloader
+		handler.Debug = true
+		mux.Handle(RELOAD_PATH, reloader)
+
+		watch(c.routes, func(changed []string) error { return handler.Routes.Reload(changed) }, reloader)
+		watch(c.layouts, func(changed []string) error { return handler.Layouts.Reload(changed) }, reloader)
+		watch(c.assets, func(changed []string) error { assets.Reset(); return nil }, reloader)
+	}
+
+	log.Printf("serving %s on http://%s", c.routes, *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+func watch(dir string, reload func(changed []string) error, reloader *templating.Reloader) {
+	watcher := templating.NewWatcher(os.DirFS(dir), WATCH_INTERVAL)
+	go watcher.Watch(context.Background(), func(changed []string) {
+		err := reload(changed)
+		if err != nil {
+			log.Println(err)
+		}
+		reloader.Reload()
+	})
+}
+
+func export(args []string) error {
+	c := newConfig("export", "<dir>")
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+
+	if c.flags.NArg() != 1 {
+		c.flags.Usage()
+		return flag.ErrHelp
+	}
+
+	handler, assets, err := c.handler()
+	if err != nil {
+		log.Println(err)
+	}
+
+	report, err := templating.NewExporter(handler, assets).Export(c.flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("exported %d pages, skipped %v\n", len(report.Pages), report.Skipped)
+	if !report.OK() {
+		return errors.New(report.String())
+	}
+
+	return nil
+}
@@ -3,13 +3,14 @@ module github.com/Simon-Martens/misc_tests
 go 1.23.2
 
 require (
+	github.com/Simon-Martens/pc_testthings v0.0.0
+	github.com/labstack/echo/v4 v4.12.0
 	github.com/pocketbase/pocketbase v0.22.21
 	github.com/yalue/merged_fs v1.3.0
 )
 
 require (
 	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
-	github.com/labstack/echo/v4 v4.12.0 // indirect
 	github.com/labstack/gommon v0.4.2 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
@@ -21,3 +22,6 @@ require (
 	golang.org/x/text v0.17.0 // indirect
 	golang.org/x/time v0.6.0 // indirect
 )
+
+// INFO: test_things is developed alongside, it ships routes as an embeddable package
+replace github.com/Simon-Martens/pc_testthings => ./views/test_things
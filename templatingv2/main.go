@@ -1,63 +1,158 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/Simon-Martens/misc_tests/templating"
+	"github.com/Simon-Martens/misc_tests/templating/funcs"
 	"github.com/Simon-Martens/misc_tests/views"
+	testthings "github.com/Simon-Martens/pc_testthings"
 	"github.com/labstack/echo/v4"
 )
 
-const ROOT_LAYOUT_NAME = "root"
 const DEFAULT_LAYOUT_NAME = "default"
+const ASSETS_PATH = "/assets/"
+const THINGS_PATH = "/things/"
+const LIVE_PATH = "/_live"
+const COMPONENT_PATH = "/_c/"
 
 var lr *templating.LayoutRegistry
 var tr *templating.TemplateRegistry
 
 func main() {
+	export := flag.String("export", "", "render all routes that need no data into this directory and exit")
+	flag.Parse()
+
 	e := echo.New()
 
 	lr = templating.NewLayoutRegistry(views.LayoutFS)
-	tr = templating.NewTemplateRegistry(views.RoutesFS)
-
-	tr.Parse()
+	tr = templating.NewTemplateRegistry(views.RoutesFS).Register(THINGS_PATH, testthings.RoutesFS)
+
+	assets := templating.NewAssets(ASSETS_PATH, views.StaticFS)
+	vite := templating.NewVite(assets)
+	live := templating.NewLive(LIVE_PATH)
+	live.Register("counter", counter{})
+	live.RegisterPreLoad("slow", slow{})
+
+	lr.RegisterFuncs(funcs.Standard())
+	tr.RegisterFuncs(funcs.Standard())
+	lr.RegisterFuncs(assets.Funcs())
+	tr.RegisterFuncs(assets.Funcs())
+	lr.RegisterFuncs(vite.Funcs())
+	tr.RegisterFuncs(vite.Funcs())
+	lr.RegisterFuncs(live.Funcs())
+	tr.RegisterFuncs(live.Funcs())
+
+	// INFO: release builds refuse to start with broken templates, dev builds serve the healthy ones
+	lr.SetMode(PARSE_MODE)
+	tr.SetMode(PARSE_MODE)
+	lr.SetCollisionPolicy(COLLISION_POLICY)
+	tr.SetCollisionPolicy(COLLISION_POLICY)
+
+	err := lr.Parse()
+	if err != nil {
+		report(err)
+	}
 
-	e.GET("/*", getEverything(lr, tr))
+	err = tr.Parse()
+	if err != nil {
+		report(err)
+	}
 
-	e.Logger.Fatal(e.Start("127.0.0.1:1323"))
-}
+	tr.Load("/test_dynamic/[id]", func(r *http.Request, params templating.Params) (any, error) {
+		id, err := strconv.Atoi(params.Get("id"))
+		if err != nil {
+			return nil, templating.NewHTTPError(http.StatusNotFound, err)
+		}
 
-func getEverything(layouts *templating.LayoutRegistry, routes *templating.TemplateRegistry) func(c echo.Context) error {
-	return func(c echo.Context) error {
+		return map[string]any{"id": id, "next": id + 1}, nil
+	})
 
-		path := c.Request().URL.Path
+	handler := templating.NewHandler(lr, tr)
+	handler.Layout = DEFAULT_LAYOUT_NAME
+	handler.Live = live
+	// INFO: only components named hx_* can be fetched on their own, see TEMPLATE_ENDPOINT_PREFIX
+	handler.ComponentPath = COMPONENT_PATH
 
-		layout, err := layouts.Get(DEFAULT_LAYOUT_NAME)
+	if *export != "" {
+		exporter := templating.NewExporter(handler, assets)
+		report, err := exporter.Export(*export)
 		if err != nil {
-			return c.String(500, err.Error())
+			log.Fatal(err)
 		}
 
-		// We clone this here, since driver templates can only be executed once
-		layout, err = layout.Clone()
-		if err != nil {
-			return c.String(500, err.Error())
+		log.Printf("exported %d pages, skipped %v", len(report.Pages), report.Skipped)
+		if !report.OK() {
+			log.Fatal(report)
 		}
+		return
+	}
 
-		err = routes.Add(path, layout)
-		// FIXME: we should react do different error types differntly
-		if err != nil {
-			return c.String(500, err.Error())
-		}
+	dev(e, handler, assets, vite)
+
+	e.GET(ASSETS_PATH+"*", echo.WrapHandler(assets))
+	e.Match([]string{http.MethodGet, http.MethodPost}, LIVE_PATH, echo.WrapHandler(live))
+	go live.Sweep(context.Background())
+	e.Match([]string{http.MethodGet, http.MethodPost}, COMPONENT_PATH+"*", handler.Echo())
+	e.GET("/*", handler.Echo())
+
+	e.Logger.Fatal(e.Start("127.0.0.1:1323"))
+}
 
-		// TODO: we should probably reuse buffers here to avoid allocations
-		var buffer bytes.Buffer
+// INFO: counter is the live controller of the test_live route
+type counter struct{}
+
+type count struct {
+	Count int
+}
 
-		err = layout.Execute(&buffer, nil)
+func (counter) Mount(r *http.Request, data any) (any, error) {
+	start, _ := data.(int)
+	return count{Count: start}, nil
+}
+
+func (counter) HandleEvent(event string, values url.Values, state any) (any, error) {
+	c := state.(count)
+	switch event {
+	case "increment":
+		c.Count++
+	case "decrement":
+		c.Count--
+	case "set":
+		n, err := strconv.Atoi(values.Get("count"))
 		if err != nil {
-			return c.String(500, err.Error())
+			return nil, templating.NewHTTPError(http.StatusBadRequest, err)
 		}
+		c.Count = n
+	}
 
-		return c.HTML(200, buffer.String())
+	return c, nil
+}
+
+// INFO: slow is the preload controller of the test_preload route, it takes as many seconds as it is told
+type slow struct{}
 
+func (slow) PreLoad(r *http.Request, data any) (any, error) {
+	seconds, _ := data.(int)
+	select {
+	case <-time.After(time.Duration(seconds) * time.Second):
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
 	}
+
+	return map[string]any{"Seconds": seconds, "At": time.Now()}, nil
+}
+
+func report(err error) {
+	if PARSE_MODE == templating.Strict {
+		log.Fatal(err)
+	}
+
+	log.Println(err)
 }
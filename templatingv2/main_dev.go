@@ -0,0 +1,70 @@
+//go:build dev
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Simon-Martens/misc_tests/templating"
+	"github.com/Simon-Martens/misc_tests/views"
+	"github.com/labstack/echo/v4"
+)
+
+const DEV_RELOAD_PATH = "/_reload"
+const DEV_WATCH_INTERVAL = 500 * time.Millisecond
+const PARSE_MODE = templating.Lenient
+const COLLISION_POLICY = templating.WarnCollisions
+
+// INFO: set to the URL of a running Vite dev server, e.g. "http://localhost:5173", to load scripts with HMR
+const DEV_VITE_SERVER_ENV = "VITE_DEV_SERVER"
+
+// INFO: the dev server is proxied at this path, it must match the base of the dev server in vite.config.js
+const DEV_VITE_PATH = "/_vite/"
+
+// INFO: In dev builds, the views are read from disk. We watch them for changes, reparse the
+// affected templates and tell the browser to reload the page. Server errors show the debug page.
+func dev(e *echo.Echo, handler *templating.Handler, assets *templating.Assets, vite *templating.Vite) {
+	reloader := templating.NewReloader(DEV_RELOAD_PATH)
+	handler.Reloader = reloader
+	handler.Debug = true
+	e.GET(DEV_RELOAD_PATH, echo.WrapHandler(reloader))
+
+	if server := strings.TrimSuffix(os.Getenv(DEV_VITE_SERVER_ENV), "/"); server != "" {
+		proxy, err := vite.Proxy(server)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		e.Any(DEV_VITE_PATH+"*", echo.WrapHandler(proxy))
+		vite.DevServer = strings.TrimSuffix(DEV_VITE_PATH, "/")
+	}
+
+	routes := templating.NewWatcher(views.RoutesFS, DEV_WATCH_INTERVAL)
+	go routes.Watch(context.Background(), func(changed []string) {
+		err := handler.Routes.Reload(changed)
+		if err != nil {
+			log.Println(err)
+		}
+		reloader.Reload()
+	})
+
+	layouts := templating.NewWatcher(views.LayoutFS, DEV_WATCH_INTERVAL)
+	go layouts.Watch(context.Background(), func(changed []string) {
+		err := handler.Layouts.Reload(changed)
+		if err != nil {
+			log.Println(err)
+		}
+		reloader.Reload()
+	})
+
+	static := templating.NewWatcher(views.StaticFS, DEV_WATCH_INTERVAL)
+	go static.Watch(context.Background(), func(changed []string) {
+		assets.Reset()
+		vite.Reset()
+		reloader.Reload()
+	})
+}
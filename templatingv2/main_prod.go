@@ -0,0 +1,14 @@
+//go:build !dev
+
+package main
+
+import (
+	"github.com/Simon-Martens/misc_tests/templating"
+	"github.com/labstack/echo/v4"
+)
+
+const PARSE_MODE = templating.Strict
+const COLLISION_POLICY = templating.ForbidCollisions
+
+func dev(e *echo.Echo, handler *templating.Handler, assets *templating.Assets, vite *templating.Vite) {
+}
@@ -0,0 +1,205 @@
+package templating
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/store"
+)
+
+// INFO: length of the content hash inserted into asset URLs, in hex characters
+const ASSET_HASH_LENGTH = 16
+
+// Assets serves a static FS under a URL prefix. Asset URLs are fingerprinted with a hash of their
+// content, e.g. /assets/style.3f2a1b9c0d4e5f60.css, so they can be cached forever. Precompressed
+// variants (style.css.br, style.css.gz) are served to clients accepting them.
+type Assets struct {
+	// INFO: URL path prefix the assets are mounted at, with trailing slash, e.g. "/assets/"
+	Prefix string
+	fsys   fs.FS
+	// INFO: content hashes keyed by FS path, computed on first use
+	hashes *store.Store[string]
+}
+
+func NewAssets(prefix string, fsys fs.FS) *Assets {
+	return &Assets{
+		Prefix: FSPathToPath(PathToFSPath(prefix)),
+		fsys:   fsys,
+		hashes: store.New[string](nil),
+	}
+}
+
+// Funcs returns the asset func for templates: {{ asset "style.css" }} renders the fingerprinted URL
+func (a *Assets) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"asset": a.URL,
+	}
+}
+
+// URL returns the fingerprinted URL of an asset, name being its path in the FS
+func (a *Assets) URL(name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+	hash, err := a.hash(name)
+	if err != nil {
+		return "", err
+	}
+
+	ext := path.Ext(name)
+	return a.Prefix + strings.TrimSuffix(name, ext) + "." + hash + ext, nil
+}
+
+// Reset discards all computed hashes, e.g. after files changed in dev builds
+func (a *Assets) Reset() {
+	a.hashes.RemoveAll()
+}
+
+// INFO: public reports whether an asset may be served. Dot files and directories, e.g. the
+// .vite directory, and the Vite manifest are build metadata, not assets.
+func public(name string) bool {
+	if slices.Contains(VITE_MANIFEST_FILES, name) {
+		return false
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *Assets) hash(name string) (string, error) {
+	if !public(name) {
+		return "", NewError(FileAccessError, name)
+	}
+
+	hash := a.hashes.Get(name)
+	if hash != "" {
+		return hash, nil
+	}
+
+	data, err := fs.ReadFile(a.fsys, name)
+	if err != nil {
+		return "", NewError(FileAccessError, name)
+	}
+
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])[:ASSET_HASH_LENGTH]
+	a.hashes.Set(name, hash)
+
+	return hash, nil
+}
+
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, a.Prefix)), "/")
+	name, fingerprint := a.resolve(name)
+
+	hash, err := a.hash(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// INFO: fingerprinted URLs never change their content. Outdated fingerprints get the current
+	// content, but must not be cached forever, the same goes for plain URLs.
+	if fingerprint == hash {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	file := name
+	etag := hash
+	encoding := a.encoding(r, name)
+	if encoding != "" {
+		file = name + encodingExtensions[encoding]
+		etag = hash + "-" + encoding
+		w.Header().Set("Content-Encoding", encoding)
+	}
+
+	data, err := fs.ReadFile(a.fsys, file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// INFO: ServeContent answers If-None-Match with 304 Not Modified, based on the ETag
+	w.Header().Set("ETag", `"`+etag+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// INFO: resolve strips the fingerprint from an asset name, unless a file with that exact name exists
+func (a *Assets) resolve(name string) (string, string) {
+	if _, err := fs.Stat(a.fsys, name); err == nil {
+		return name, ""
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	hashext := path.Ext(base)
+	if len(hashext) != ASSET_HASH_LENGTH+1 {
+		return name, ""
+	}
+
+	return strings.TrimSuffix(base, hashext) + ext, hashext[1:]
+}
+
+var encodingExtensions = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// INFO: encoding picks a precompressed variant of name accepted by the client, brotli first
+func (a *Assets) encoding(r *http.Request, name string) string {
+	accepted := r.Header.Get("Accept-Encoding")
+
+	for _, encoding := range []string{"br", "gzip"} {
+		if !acceptsEncoding(accepted, encoding) {
+			continue
+		}
+
+		if _, err := fs.Stat(a.fsys, name+encodingExtensions[encoding]); err == nil {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(name) != encoding {
+			continue
+		}
+
+		// INFO: q=0 explicitly refuses an encoding
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+
+	return false
+}
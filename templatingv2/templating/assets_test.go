@@ -0,0 +1,78 @@
+package templating
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func assetsFS() fstest.MapFS {
+	return fstest.MapFS{
+		"style.css":           {Data: []byte(`body {}`)},
+		"js/main.js":          {Data: []byte(`console.log(1)`)},
+		".vite/manifest.json": {Data: []byte(`{}`)},
+		"manifest.json":       {Data: []byte(`{}`)},
+		".env":                {Data: []byte(`SECRET=1`)},
+		"js/.hidden.js":       {Data: []byte(`hidden`)},
+	}
+}
+
+func TestAssetsServeHTTP(t *testing.T) {
+	a := NewAssets("/assets/", assetsFS())
+
+	css, err := a.URL("style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/assets/style.css", http.StatusOK},
+		{css, http.StatusOK},
+		{"/assets/js/main.js", http.StatusOK},
+		{"/assets/.vite/manifest.json", http.StatusNotFound},
+		{"/assets/manifest.json", http.StatusNotFound},
+		{"/assets/.env", http.StatusNotFound},
+		{"/assets/js/.hidden.js", http.StatusNotFound},
+		{"/assets/js/../.env", http.StatusNotFound},
+		{"/assets/missing.css", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("GET %s: status %d, want %d", tt.path, rec.Code, tt.code)
+		}
+	}
+
+	if _, err := a.URL(".vite/manifest.json"); err == nil {
+		t.Error("URL(.vite/manifest.json): expected an error")
+	}
+}
+
+func TestAssetsExport(t *testing.T) {
+	dir := t.TempDir()
+
+	err := NewAssets("/assets/", assetsFS()).Export(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"style.css", "js/main.js"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{".vite", "manifest.json", ".env", "js/.hidden.js"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: must not be exported", name)
+		}
+	}
+}
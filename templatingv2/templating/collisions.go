@@ -0,0 +1,140 @@
+package templating
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// INFO: CollisionKind tells apart the two ways templates of the same name meet
+type CollisionKind int
+
+const (
+	// INFO: a template shadows a template of the same name inherited from a parent directory, e.g. a local
+	// overriding a global component, or x.tmpl overriding components/x.tmpl. This is how overrides work,
+	// so it is never an error.
+	Shadow CollisionKind = iota
+	// INFO: two templates of the same directory have the same name, e.g. x.tmpl and x.html,
+	// or two files {{ define }} the same template. Only one of them can be used.
+	Clash
+)
+
+func (k CollisionKind) String() string {
+	if k == Clash {
+		return "clash"
+	}
+	return "shadow"
+}
+
+// Collision describes templates of the same name. Files lists the files providing the name,
+// the one used last, e.g. [parent global, local] for a local shadowing a global.
+type Collision struct {
+	Name  string
+	Kind  CollisionKind
+	Files []string
+}
+
+func (c Collision) String() string {
+	used := c.Files[len(c.Files)-1]
+	others := strings.Join(c.Files[:len(c.Files)-1], ", ")
+	if c.Kind == Clash {
+		return fmt.Sprintf("template %q is defined by %s and %s, using %s", c.Name, others, used, used)
+	}
+	return fmt.Sprintf("template %q of %s shadows %s", c.Name, used, others)
+}
+
+// INFO: collide applies a collision policy to the collisions of a route or layout. Forbidden
+// collisions are returned as an error, which marks the route or layout as broken.
+func collide(policy CollisionPolicy, path string, collisions []Collision) error {
+	errs := []error{}
+	for _, c := range collisions {
+		switch {
+		case policy == ForbidCollisions && c.Kind == Clash:
+			errs = append(errs, NewError(TemplateCollisionError, path+": "+c.String()))
+		case policy >= WarnCollisions:
+			log.Printf("templating: %s: %s", path, c)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Inherit passes the global components of a parent directory down to this directory, along with
+// the files they shadow. Call it before Parse, so the globals of this directory shadow the inherited ones.
+func (c *TemplateContext) Inherit(parent TemplateContext) {
+	c.SetGlobals(parent.GetGlobals())
+	for k, v := range parent.shadows {
+		c.shadows[k] = slices.Clone(v)
+	}
+	c.inherited = append(slices.Clone(parent.inherited), FSPathToPath(PathToFSPath(parent.Path)))
+}
+
+// INFO: define adds a template file found by Parse. own holds the templates of this directory found
+// so far: templates of the directory itself are found first and win over those in the components directory.
+// A template of the directory overriding a component is a shadow, like a local overriding a global.
+func (c *TemplateContext) define(name, file string, global, component bool, own map[string]string) {
+	if prev, ok := own[name]; ok {
+		kind := Clash
+		if component && !c.isComponent(prev) {
+			kind = Shadow
+		}
+
+		c.collisions = append(c.collisions, Collision{Name: name, Kind: kind, Files: []string{file, prev}})
+		return
+	}
+	own[name] = file
+
+	shadowed := []string{}
+	if inherited, ok := c.globals[name]; ok {
+		shadowed = append(slices.Clone(c.shadows[name]), inherited)
+		c.collisions = append(c.collisions, Collision{Name: name, Kind: Shadow, Files: append(slices.Clone(shadowed), file)})
+	}
+
+	if global {
+		c.globals[name] = file
+		// INFO: only globals are passed down, a local shadows the inherited global in this directory only
+		c.shadows[name] = shadowed
+	} else {
+		c.locals[name] = file
+	}
+}
+
+// Collisions lists the templates of this directory sharing a name with another template, see Parse.
+// Templates clashing by {{ define }} are only found on Get.
+func (c *TemplateContext) Collisions() []Collision {
+	return slices.Clone(c.collisions)
+}
+
+// INFO: shadowed returns the files hidden by the template of a name, oldest first
+func (c *TemplateContext) shadowed(name string) []string {
+	files := slices.Clone(c.shadows[name])
+	if _, ok := c.locals[name]; ok {
+		if g, ok := c.globals[name]; ok {
+			files = append(files, g)
+		}
+	}
+
+	// INFO: inherited shadows are covered above, the collisions of this directory only name their own files
+	for _, collision := range c.collisions {
+		if collision.Name == name && c.isOwn(collision.Files[0]) {
+			files = append(files, collision.Files[:len(collision.Files)-1]...)
+		}
+	}
+
+	return files
+}
+
+// INFO: isOwn reports whether an FS path is a template of this directory, including its components
+func (c *TemplateContext) isOwn(file string) bool {
+	dir := PathToFSPath(c.Path)
+	// INFO: the root directory inherits nothing
+	return dir == "." || strings.HasPrefix(file, dir+"/")
+}
+
+// INFO: isComponent reports whether an FS path is in the components directory of this directory
+func (c *TemplateContext) isComponent(file string) bool {
+	return strings.HasPrefix(file, filepath.ToSlash(filepath.Join(PathToFSPath(c.Path), TEMPLATE_COMPONENT_DIRECTORY))+"/")
+}
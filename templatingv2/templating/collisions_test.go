@@ -0,0 +1,128 @@
+package templating
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func collisionRoutes() fstest.MapFS {
+	return fstest.MapFS{
+		"body.tmpl":                  {Data: []byte(`root {{ template "_card" . }}`)},
+		"components/_card.tmpl":      {Data: []byte(`root card`)},
+		"posts/body.tmpl":            {Data: []byte(`posts {{ template "_card" . }} {{ template "item" . }}`)},
+		"posts/_card.tmpl":           {Data: []byte(`posts card`)},
+		"posts/item.tmpl":            {Data: []byte(`item`)},
+		"posts/components/item.tmpl": {Data: []byte(`component item`)},
+		"clash/body.tmpl":            {Data: []byte(`{{ template "x" . }}`)},
+		"clash/x.tmpl":               {Data: []byte(`x tmpl`)},
+		"clash/x.html":               {Data: []byte(`x html`)},
+		"defines/body.tmpl":          {Data: []byte(`{{ template "y" . }}`)},
+		"defines/a.tmpl":             {Data: []byte(`{{ define "y" }}a{{ end }}`)},
+		"defines/b.tmpl":             {Data: []byte(`{{ define "y" }}b{{ end }}`)},
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	tr := NewTemplateRegistry(collisionRoutes())
+	tr.Parse()
+
+	tests := []struct {
+		route string
+		want  []Collision
+	}{
+		{"/", nil},
+		{"/posts/", []Collision{
+			{Name: "_card", Kind: Shadow, Files: []string{"components/_card.tmpl", "posts/_card.tmpl"}},
+			{Name: "item", Kind: Shadow, Files: []string{"posts/components/item.tmpl", "posts/item.tmpl"}},
+		}},
+		{"/clash/", []Collision{
+			{Name: "x", Kind: Clash, Files: []string{"clash/x.tmpl", "clash/x.html"}},
+		}},
+		{"/defines/", []Collision{
+			{Name: "y", Kind: Clash, Files: []string{"defines/a.tmpl", "defines/b.tmpl"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		got := tr.Collisions(tt.route)
+		slices.SortFunc(got, func(a, b Collision) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+
+		if len(got) != len(tt.want) {
+			t.Errorf("Collisions(%s) = %v, want %v", tt.route, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Name != tt.want[i].Name || got[i].Kind != tt.want[i].Kind || !slices.Equal(got[i].Files, tt.want[i].Files) {
+				t.Errorf("Collisions(%s)[%d] = %+v, want %+v", tt.route, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	// INFO: the shadowed files show up in the sources of the template used
+	for _, s := range tr.Sources("/posts/") {
+		if s.Name == "item" && !slices.Equal(s.Shadows, []string{"posts/components/item.tmpl"}) {
+			t.Errorf("Sources(/posts/) item shadows %v", s.Shadows)
+		}
+		if s.Name == "_card" && !slices.Equal(s.Shadows, []string{"components/_card.tmpl"}) {
+			t.Errorf("Sources(/posts/) _card shadows %v", s.Shadows)
+		}
+	}
+}
+
+func TestCollisionPolicies(t *testing.T) {
+	tests := []struct {
+		policy CollisionPolicy
+		broken []string
+	}{
+		{AllowCollisions, []string{}},
+		{WarnCollisions, []string{}},
+		// INFO: shadows are how overrides work, only clashes break a route
+		{ForbidCollisions, []string{"/clash/", "/defines/"}},
+	}
+
+	for _, tt := range tests {
+		tr := NewTemplateRegistry(collisionRoutes())
+		tr.SetCollisionPolicy(tt.policy)
+
+		err := tr.Parse()
+		if (err != nil) != (len(tt.broken) > 0) {
+			t.Errorf("policy %d: Parse() = %v", tt.policy, err)
+		}
+
+		broken := []string{}
+		for route, err := range tr.Broken() {
+			if !errors.Is(err, TemplateCollisionError) {
+				t.Errorf("policy %d: %s: %v, want TemplateCollisionError", tt.policy, route, err)
+			}
+			broken = append(broken, route)
+		}
+		slices.Sort(broken)
+
+		if !slices.Equal(broken, tt.broken) {
+			t.Errorf("policy %d: broken %v, want %v", tt.policy, broken, tt.broken)
+		}
+	}
+}
+
+// INFO: with ForbidCollisions and Strict mode, overriding components must not keep the registry from parsing
+func TestCollisionShadowsAreNotForbidden(t *testing.T) {
+	tr := NewTemplateRegistry(fstest.MapFS{
+		"body.tmpl":                  {Data: []byte(`root`)},
+		"components/_card.tmpl":      {Data: []byte(`root card`)},
+		"posts/body.tmpl":            {Data: []byte(`{{ template "_card" . }} {{ template "item" . }}`)},
+		"posts/_card.tmpl":           {Data: []byte(`posts card`)},
+		"posts/item.tmpl":            {Data: []byte(`item`)},
+		"posts/components/item.tmpl": {Data: []byte(`component item`)},
+	})
+	tr.SetMode(Strict)
+	tr.SetCollisionPolicy(ForbidCollisions)
+
+	if err := tr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+}
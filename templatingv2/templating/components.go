@@ -0,0 +1,83 @@
+package templating
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+)
+
+// Slot is rendered child content passed to a component, see the slot func
+type Slot struct {
+	Name string
+	HTML template.HTML
+}
+
+// INFO: componentFuncs are bound to the template set being executed, since components are looked up
+// in it. The registries parse with unbound funcs (t == nil), add binds them for every page.
+//
+// Usage:
+//
+//	{{ define "card_body" }}<p>Hello {{ .Name }}</p>{{ end }}
+//	{{ component "card" (dict "title" "Welcome") (slot "body" "card_body" .) }}
+//
+// The card component renders its props and slots from its dot: {{ .title }} and {{ .slots.body }}.
+// Missing slots render empty, e.g. {{ .slots.footer | default "Default footer" }} for a fallback.
+func componentFuncs(t *template.Template) template.FuncMap {
+	return template.FuncMap{
+		"component": func(name string, args ...any) (template.HTML, error) {
+			if t == nil {
+				return "", NewError(NoComponentContextError, name)
+			}
+
+			data := map[string]any{}
+			slots := map[string]template.HTML{}
+			for _, arg := range args {
+				switch arg := arg.(type) {
+				case map[string]any:
+					for k, v := range arg {
+						data[k] = v
+					}
+				case Slot:
+					slots[arg.Name] = arg.HTML
+				default:
+					return "", NewError(InvalidComponentArgError, fmt.Sprintf("%s: %T", name, arg))
+				}
+			}
+			data[TEMPLATE_SLOTS_KEY] = slots
+
+			return executeComponent(t, name, data)
+		},
+		"slot": func(name, component string, data ...any) (Slot, error) {
+			if t == nil {
+				return Slot{}, NewError(NoComponentContextError, component)
+			}
+
+			var dot any
+			if len(data) > 0 {
+				dot = data[0]
+			}
+
+			html, err := executeComponent(t, component, dot)
+			if err != nil {
+				return Slot{}, err
+			}
+
+			return Slot{Name: name, HTML: html}, nil
+		},
+	}
+}
+
+func executeComponent(t *template.Template, name string, data any) (template.HTML, error) {
+	if t.Lookup(name) == nil {
+		return "", NewError(NoTemplateError, name)
+	}
+
+	var buffer bytes.Buffer
+	err := t.ExecuteTemplate(&buffer, name, data)
+	if err != nil {
+		return "", err
+	}
+
+	// INFO: the component is escaped by html/template on execution, its output is safe
+	return template.HTML(buffer.String()), nil
+}
@@ -4,9 +4,50 @@ var TEMPLATE_FORMATS = []string{".html", ".tmpl", ".gotmpl", ".gotemplate", ".go
 
 const TEMPLATE_GLOBAL_CONTEXT_NAME = "globals"
 const TEMPLATE_ROOT_NAME = "root"
+const TEMPLATE_DEFAULT_LAYOUT = "default"
 const TEMPLATE_LOCAL_CONTEXT_NAME = "locals"
 const TEMPLATE_GLOBAL_PREFIX = "_"
 const TEMPLATE_COMPONENT_DIRECTORY = "components"
 const TEMPLATE_HEAD = "head"
 const TEMPLATE_BODY = "body"
 const TEMPLATE_HEADERS = "headers"
+
+// INFO: error pages are named by status code, e.g. 404.tmpl, or TEMPLATE_ERROR for all other codes
+const TEMPLATE_ERROR = "error"
+
+// INFO: templates starting with this prefix are appended to htmx partial responses, for out-of-band swaps
+const TEMPLATE_OOB_PREFIX = "oob_"
+
+// INFO: the key of the slots in the dot of a component rendered by the component func, e.g. {{ .slots.body }}
+const TEMPLATE_SLOTS_KEY = "slots"
+
+// INFO: components opt in to be served on their own by the Handler with this prefix, e.g. hx_clock.tmpl,
+// see Handler.ComponentPath. Global components combine both prefixes, e.g. _hx_clock.tmpl.
+const TEMPLATE_ENDPOINT_PREFIX = "hx_"
+
+// INFO: a plain text file containing the name of a layout, e.g. "default/admin".
+// In route directories it selects the layout for the directory and all subdirectories,
+// in layout directories it selects the parent layout the layout is nested in.
+const TEMPLATE_LAYOUT_FILE = "layout"
+
+// INFO: ParseMode controls how the registries treat broken templates when parsing
+type ParseMode int
+
+const (
+	// INFO: healthy templates are served, broken ones respond with their error
+	Lenient ParseMode = iota
+	// INFO: any broken template fails parsing, the registry keeps its previous state
+	Strict
+)
+
+// INFO: CollisionPolicy controls how the registries treat templates sharing a name, see Collision
+type CollisionPolicy int
+
+const (
+	// INFO: collisions are only recorded, see TemplateRegistry.Collisions
+	AllowCollisions CollisionPolicy = iota
+	// INFO: collisions are logged on parsing
+	WarnCollisions
+	// INFO: clashes break the route or layout, shadowing is logged
+	ForbidCollisions
+)
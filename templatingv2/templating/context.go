@@ -1,13 +1,22 @@
 package templating
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
 	"io/fs"
+	"maps"
 	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"text/template/parse"
 )
 
+// INFO: html/template reports functions missing from the FuncMap only as a parse error message
+var undefinedFunc = regexp.MustCompile(`function "[^"]*" not defined`)
+
 type TemplateContext struct {
 	//  WARNING: Path is a URL path, NOT a filesystem path
 	Path string
@@ -15,6 +24,17 @@ type TemplateContext struct {
 	// The values are FS paths absolute from the root directory of the templates FS
 	locals  map[string]string
 	globals map[string]string
+	// INFO: error pages of this directory, e.g. "404" or "error". They are not part of the locals,
+	// since they are only added to the template set when rendering an error.
+	errors map[string]string
+	// INFO: Name of the layout as set by a layout file in this or a parent directory
+	Layout string
+	// INFO: the files shadowed by each global, oldest first, see Inherit
+	shadows map[string][]string
+	// INFO: templates sharing a name, found by Parse
+	collisions []Collision
+	// INFO: the directories whose globals this directory inherited, from the root down, see Inherit
+	inherited []string
 }
 
 func NewTemplateContext(path string) TemplateContext {
@@ -22,6 +42,8 @@ func NewTemplateContext(path string) TemplateContext {
 		Path:    path,
 		locals:  make(map[string]string),
 		globals: make(map[string]string),
+		errors:  make(map[string]string),
+		shadows: make(map[string][]string),
 	}
 }
 
@@ -33,33 +55,22 @@ func (c *TemplateContext) Parse(fsys fs.FS) error {
 		return NewError(InvalidPathError, c.Path)
 	}
 
-	for _, e := range entries {
-		if e.IsDir() {
-			// INFO: components in the components directory can be overwritten
-			// by components in the base directory down below
-			// TODO: Maybe allow for subdirectories in the components directory?
-			if e.Name() == TEMPLATE_COMPONENT_DIRECTORY {
-				entries, err := fs.ReadDir(fsys, filepath.Join(fspath, e.Name()))
-				if err != nil {
-					return NewError(FileAccessError, filepath.Join(fspath, e.Name()))
-				}
+	// INFO: the templates of this directory by name, to detect clashes
+	own := make(map[string]string)
 
-				for _, e := range entries {
-					ext := filepath.Ext(e.Name())
+	for _, e := range entries {
+		if !e.IsDir() && e.Name() == TEMPLATE_LAYOUT_FILE {
+			text, err := fs.ReadFile(fsys, filepath.Join(fspath, e.Name()))
+			if err != nil {
+				return NewError(FileAccessError, filepath.Join(fspath, e.Name()))
+			}
 
-					if !slices.Contains(TEMPLATE_FORMATS, ext) {
-						continue
-					}
+			c.Layout = strings.TrimSpace(string(text))
+			continue
+		}
 
-					name := strings.TrimSuffix(e.Name(), ext)
-					if strings.HasPrefix(e.Name(), TEMPLATE_GLOBAL_PREFIX) {
-						c.globals[name] = filepath.Join(fspath, TEMPLATE_COMPONENT_DIRECTORY, e.Name())
-					} else {
-						c.locals[name] = filepath.Join(fspath, TEMPLATE_COMPONENT_DIRECTORY, e.Name())
-					}
-				}
-				continue
-			}
+		if e.IsDir() {
+			continue
 		}
 
 		ext := filepath.Ext(e.Name())
@@ -69,16 +80,83 @@ func (c *TemplateContext) Parse(fsys fs.FS) error {
 		}
 
 		name := strings.TrimSuffix(e.Name(), ext)
-		if strings.HasPrefix(e.Name(), TEMPLATE_GLOBAL_PREFIX) {
-			c.globals[name] = filepath.Join(fspath, e.Name())
+		if isErrorTemplate(name) {
+			c.errors[name] = filepath.Join(fspath, e.Name())
 		} else {
-			c.locals[name] = filepath.Join(fspath, e.Name())
+			c.define(name, filepath.Join(fspath, e.Name()), strings.HasPrefix(e.Name(), TEMPLATE_GLOBAL_PREFIX), false, own)
 		}
 	}
 
+	// INFO: components in the components directory can be overwritten
+	// by components in the base directory above
+	components := filepath.Join(fspath, TEMPLATE_COMPONENT_DIRECTORY)
+	if info, err := fs.Stat(fsys, components); err == nil && info.IsDir() {
+		return c.parseComponents(fsys, components, own)
+	}
+
 	return nil
 }
 
+// INFO: components may be organized in subdirectories of the components directory. They are named
+// by their path inside it, e.g. components/forms/input.tmpl is "forms/input". A component is global
+// if its file name or any of its subdirectories starts with the global prefix, e.g. "_forms/input".
+func (c *TemplateContext) parseComponents(fsys fs.FS, dir string, own map[string]string) error {
+	return fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return NewError(FileAccessError, path)
+		}
+
+		ext := filepath.Ext(d.Name())
+		if d.IsDir() || !slices.Contains(TEMPLATE_FORMATS, ext) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return NewError(FileAccessError, path)
+		}
+
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ext)
+		c.define(name, path, isGlobalComponent(name), true, own)
+
+		return nil
+	})
+}
+
+// INFO: name is the path of a component inside the components directory, without extension
+func isGlobalComponent(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, TEMPLATE_GLOBAL_PREFIX) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// INFO: error templates are named by a 4xx or 5xx status code, or TEMPLATE_ERROR for all codes
+func isErrorTemplate(name string) bool {
+	if name == TEMPLATE_ERROR {
+		return true
+	}
+
+	if len(name) != 3 || (name[0] != '4' && name[0] != '5') {
+		return false
+	}
+
+	return strings.Trim(name, "0123456789") == ""
+}
+
+// INFO: ErrorTemplate returns the FS path of the error page for a status code, if the directory has one
+func (c *TemplateContext) ErrorTemplate(code int) (string, bool) {
+	if p, ok := c.errors[strconv.Itoa(code)]; ok {
+		return p, true
+	}
+
+	p, ok := c.errors[TEMPLATE_ERROR]
+	return p, ok
+}
+
 func (c *TemplateContext) SetGlobals(globals map[string]string) error {
 	// INFO: this allows for overwriting of existing global keys.
 	// Make sure to call this appopriately before or after Parse(), depending on your use case
@@ -92,30 +170,104 @@ func (c *TemplateContext) GetGlobals() map[string]string {
 	return c.globals
 }
 
-func (c *TemplateContext) Get(fsys fs.FS) (*template.Template, error) {
-	t, err := readTemplates(fsys, nil, c.globals)
+// Source describes where a template of a context is read from
+type Source struct {
+	Name string
+	File string
+	// INFO: TEMPLATE_GLOBAL_CONTEXT_NAME or TEMPLATE_LOCAL_CONTEXT_NAME
+	Context string
+	// INFO: files of templates of the same name hidden by this one, oldest first, see Collision
+	Shadows []string
+}
+
+// Sources lists all templates of the context by name, locals overwriting globals of the same name
+func (c *TemplateContext) Sources() []Source {
+	sources := make(map[string]Source, len(c.globals)+len(c.locals))
+	for k, v := range c.globals {
+		sources[k] = Source{Name: k, File: v, Context: TEMPLATE_GLOBAL_CONTEXT_NAME, Shadows: c.shadowed(k)}
+	}
+	for k, v := range c.locals {
+		sources[k] = Source{Name: k, File: v, Context: TEMPLATE_LOCAL_CONTEXT_NAME, Shadows: c.shadowed(k)}
+	}
+
+	list := slices.Collect(maps.Values(sources))
+	slices.SortFunc(list, func(a, b Source) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+// Has reports whether a template file of the name is part of the context, local or global
+func (c *TemplateContext) Has(name string) bool {
+	_, local := c.locals[name]
+	_, global := c.globals[name]
+	return local || global
+}
+
+// INFO: funcs must contain all functions used by the templates, since they are needed for parsing
+func (c *TemplateContext) Get(fsys fs.FS, funcs template.FuncMap) (*template.Template, error) {
+	t, _, err := c.get(fsys, funcs)
+	return t, err
+}
+
+// INFO: get also returns the templates clashing by {{ define }}, see readTemplates
+func (c *TemplateContext) get(fsys fs.FS, funcs template.FuncMap) (*template.Template, []Collision, error) {
+	collisions := []Collision{}
+
+	t, err := readTemplates(fsys, nil, c.globals, funcs, &collisions)
 	if err != nil {
-		return nil, err
+		return nil, nil, c.parseError(err)
 	}
 
-	t, err = readTemplates(fsys, t, c.locals)
+	t, err = readTemplates(fsys, t, c.locals, funcs, &collisions)
 	if err != nil {
-		return nil, err
+		return nil, nil, c.parseError(err)
 	}
 
-	return t, nil
+	// INFO: shadowed templates were read by the globals, readTemplates only knows their names
+	for i, collision := range collisions {
+		if file, ok := c.globals[collision.Files[0]]; ok && collision.Kind == Shadow {
+			collisions[i].Files[0] = file
+		}
+	}
+
+	// INFO: directories without any templates still get an (empty) template set
+	if t == nil {
+		t = template.New(c.Path).Funcs(funcs)
+	}
+
+	return t, collisions, nil
 }
 
-func readTemplates(fsys fs.FS, t *template.Template, paths map[string]string) (*template.Template, error) {
-	for k, v := range paths {
+// INFO: parseError adds the route and the directories merged into its template set to a *ParseError
+func (c *TemplateContext) parseError(err error) error {
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		perr.Route = c.Path
+		perr.Contexts = append(slices.Clone(c.inherited), FSPathToPath(PathToFSPath(c.Path)))
+	}
+	return err
+}
+
+// INFO: readTemplates returns a *ParseError for every broken template, the caller adds route and contexts.
+// Templates defined by more than one file are added to collisions, if not nil: a clash if both files are
+// in paths, otherwise the template of paths shadows the one already in t, e.g. a local redefining a global.
+func readTemplates(fsys fs.FS, t *template.Template, paths map[string]string, funcs template.FuncMap, collisions *[]Collision) (*template.Template, error) {
+	// INFO: sorted, so the same file wins a clash on every parse
+	for _, k := range slices.Sorted(maps.Keys(paths)) {
+		v := paths[k]
 		text, err := fs.ReadFile(fsys, v)
 		if err != nil {
-			return nil, NewError(FileAccessError, v)
+			return nil, newParseError(v, k, fmt.Errorf("%w: %w", FileAccessError, err))
 		}
 
-		temp, err := template.New(k).Parse(string(text))
+		temp, err := template.New(k).Funcs(funcs).Parse(string(text))
 		if err != nil {
-			return nil, err
+			if undefinedFunc.MatchString(err.Error()) {
+				err = fmt.Errorf("%w: %w", UndefinedFuncError, err)
+			}
+			return nil, newParseError(v, k, err)
 		}
 
 		if t == nil {
@@ -124,18 +276,44 @@ func readTemplates(fsys fs.FS, t *template.Template, paths map[string]string) (*
 		}
 
 		for _, template := range temp.Templates() {
+			if collisions != nil {
+				collide := collision(t, template, paths, v)
+				if collide != nil {
+					*collisions = append(*collisions, *collide)
+				}
+			}
+
 			_, err = t.AddParseTree(template.Name(), template.Tree)
 			if err != nil {
-				return nil, err
+				return nil, newParseError(v, template.Name(), err)
 			}
 		}
 
 		_, err = t.AddParseTree(temp.Name(), temp.Tree)
 		if err != nil {
-			return nil, err
+			return nil, newParseError(v, k, err)
 		}
 
 	}
 
 	return t, nil
 }
+
+// INFO: collision reports whether adding the template read from file to t replaces a template of another file.
+// Trees record the name of the template they were parsed as, which is the name of their file.
+func collision(t *template.Template, add *template.Template, paths map[string]string, file string) *Collision {
+	prev := t.Lookup(add.Name())
+	if prev == nil || prev.Tree == nil || add.Tree == nil || parse.IsEmptyTree(prev.Tree.Root) || parse.IsEmptyTree(add.Tree.Root) {
+		return nil
+	}
+
+	if prev.Tree.ParseName == add.Tree.ParseName {
+		return nil
+	}
+
+	if prevfile, ok := paths[prev.Tree.ParseName]; ok {
+		return &Collision{Name: add.Name(), Kind: Clash, Files: []string{prevfile, file}}
+	}
+
+	return &Collision{Name: add.Name(), Kind: Shadow, Files: []string{prev.Tree.ParseName, file}}
+}
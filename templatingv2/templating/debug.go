@@ -0,0 +1,192 @@
+package templating
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// INFO: number of lines shown above and below the failing line of a template
+const debugContext = 8
+
+type debugData struct {
+	Status  int
+	Message string
+	Error   string
+	Path    string
+	Route   string
+	Layout  string
+	File    string
+	Line    int
+	Column  int
+	Source  []debugLine
+	Sources []Source
+	// INFO: templates of the layout, shown since routes are executed as part of their layout
+	LayoutSources []Source
+	Data          string
+}
+
+type debugLine struct {
+	Number    int
+	Text      string
+	Highlight bool
+}
+
+// INFO: renderDebug writes the dev error overlay: the error, the failing template source with the
+// offending line highlighted, the route, its resolved template set and the data passed to it.
+// It is only used if Handler.Debug is set, since it shows internals and data to the client.
+func (h *Handler) renderDebug(w http.ResponseWriter, r *http.Request, code int, err error, route string, data any) {
+	d := debugData{
+		Status:  code,
+		Message: http.StatusText(code),
+		Error:   err.Error(),
+		Path:    r.URL.Path,
+		Route:   route,
+	}
+
+	if route != "" {
+		d.Layout = h.Routes.Layout(route)
+		if d.Layout == "" {
+			d.Layout = h.Layout
+		}
+
+		d.Sources = h.Routes.Sources(route)
+		d.LayoutSources = h.Layouts.Sources(d.Layout)
+	}
+
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		d.File, d.Line, d.Column = perr.File, perr.Line, perr.Column
+		if d.Route == "" {
+			d.Route = perr.Route
+		}
+	} else if name, line, column, ok := position(err); ok {
+		d.Line, d.Column = line, column
+		for _, s := range append(d.Sources, d.LayoutSources...) {
+			if s.Name == name {
+				d.File = s.File
+				break
+			}
+		}
+	}
+
+	if d.File != "" {
+		d.Source = h.debugSource(d.File, d.Line)
+	}
+
+	if data != nil {
+		b, jerr := json.MarshalIndent(data, "", "  ")
+		if jerr != nil {
+			d.Data = fmt.Sprintf("%#v", data)
+		} else {
+			d.Data = string(b)
+		}
+	}
+
+	var buffer bytes.Buffer
+	terr := debugTemplate.Execute(&buffer, d)
+	if terr != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	// INFO: the debug page reloads like any page, so fixing the template brings back the page
+	if h.Reloader != nil && !IsPartial(r) {
+		inject(&buffer, h.Reloader.Script())
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	buffer.WriteTo(w)
+}
+
+// INFO: the file might belong to the routes or to the layouts, FS paths do not tell
+func (h *Handler) debugSource(file string, line int) []debugLine {
+	text, err := fs.ReadFile(h.Routes.routesFS, file)
+	if err != nil {
+		text, err = fs.ReadFile(h.Layouts.layoutsFS, file)
+		if err != nil {
+			return nil
+		}
+	}
+
+	lines := []debugLine{}
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		if line > 0 && (n < line-debugContext || n > line+debugContext) {
+			continue
+		}
+		lines = append(lines, debugLine{Number: n, Text: scanner.Text(), Highlight: n == line})
+	}
+
+	return lines
+}
+
+var debugTemplate = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"trim": strings.TrimSpace,
+}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Status }} {{ .Message }}: {{ .Path }}</title>
+<style>
+	body { margin: 0; padding: 2rem; font-family: ui-sans-serif, system-ui, sans-serif; background: #1e1e24; color: #e8e8ea; }
+	h1 { margin: 0 0 .5rem; color: #ff6b6b; font-size: 1.4rem; }
+	h2 { margin: 2rem 0 .5rem; font-size: 1rem; color: #a9a9b3; text-transform: uppercase; letter-spacing: .05em; }
+	pre, table { font-family: ui-monospace, monospace; font-size: .9rem; }
+	pre.error { white-space: pre-wrap; background: #2a2a33; padding: 1rem; border-left: 4px solid #ff6b6b; }
+	.source { background: #2a2a33; border-collapse: collapse; width: 100%; }
+	.source td { padding: 0 .75rem; white-space: pre; }
+	.source td.n { color: #6c6c78; text-align: right; user-select: none; width: 1%; }
+	.source tr.hl { background: #5c2b2b; }
+	.sources td { padding: .15rem 1rem .15rem 0; }
+	.muted { color: #8a8a96; }
+	pre.data { background: #2a2a33; padding: 1rem; overflow: auto; max-height: 30rem; }
+</style>
+</head>
+<body>
+	<h1>{{ .Status }} {{ .Message }}</h1>
+	<p class="muted">{{ .Path }}{{ with .Route }} matched route {{ . }}{{ end }}{{ with .Layout }} in layout {{ . }}{{ end }}</p>
+	<pre class="error">{{ .Error }}</pre>
+
+	{{ if .File }}
+		<h2>{{ .File }}{{ if .Line }}:{{ .Line }}{{ if .Column }}:{{ .Column }}{{ end }}{{ end }}</h2>
+		{{ if .Source }}
+			<table class="source">
+				{{ range .Source }}
+					<tr{{ if .Highlight }} class="hl"{{ end }}><td class="n">{{ .Number }}</td><td>{{ .Text }}</td></tr>
+				{{ end }}
+			</table>
+		{{ else }}
+			<p class="muted">The source of this template could not be read.</p>
+		{{ end }}
+	{{ end }}
+
+	{{ if .Sources }}
+		<h2>Route templates</h2>
+		<table class="sources">
+			{{ range .Sources }}<tr><td>{{ .Name }}</td><td class="muted">{{ .Context }}</td><td>{{ .File }}{{ range .Shadows }}<br /><span class="muted">shadows {{ . }}</span>{{ end }}</td></tr>{{ end }}
+		</table>
+	{{ end }}
+
+	{{ if .LayoutSources }}
+		<h2>Layout templates</h2>
+		<table class="sources">
+			{{ range .LayoutSources }}<tr><td>{{ .Name }}</td><td class="muted">{{ .Context }}</td><td>{{ .File }}{{ range .Shadows }}<br /><span class="muted">shadows {{ . }}</span>{{ end }}</td></tr>{{ end }}
+		</table>
+	{{ end }}
+
+	{{ with .Data }}
+		<h2>Data</h2>
+		<pre class="data">{{ . }}</pre>
+	{{ end }}
+</body>
+</html>
+`))
@@ -0,0 +1,127 @@
+package templating
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ServeComponent renders a single component of a route, without the layout and the other
+// templates of the page, e.g. for lazy loading or refreshing a part of the page with htmx:
+//
+//	<div hx-get="/_c/test_endpoints/hx_clock?zone=UTC" hx-trigger="every 1s"></div>
+//
+// The request path is ComponentPath, the route and the component name, e.g. "forms/input".
+// The dot of the component is a map of the route params and the query and form values.
+// Values given once are strings, e.g. {{ .zone }}, values given more than once are []string.
+func (h *Handler) ServeComponent(w http.ResponseWriter, r *http.Request) {
+	rest, ok := h.componentRest(r.URL.Path)
+	rest = strings.Trim(rest, "/")
+	if !ok || rest == "" {
+		h.Error(w, r, NewError(NoTemplateError, r.URL.Path))
+		return
+	}
+
+	tree, err := h.Routes.current()
+	if err != nil {
+		h.Error(w, r, err)
+		return
+	}
+
+	// INFO: route and component names both contain slashes, so we try the longest route first
+	segments := strings.Split(rest, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		route := "/" + strings.Join(segments[:i], "/")
+		name := strings.Join(segments[i:], "/")
+
+		if !isEndpoint(name, h.ComponentExposeAll) {
+			continue
+		}
+
+		t, err := h.Routes.get(tree, route, name)
+		if errors.Is(err, NoTemplateError) {
+			continue
+		}
+
+		if err != nil {
+			h.fail(w, r, err, route, nil)
+			return
+		}
+
+		h.component(w, r, tree, t, route, name)
+		return
+	}
+
+	h.Error(w, r, NewError(NoTemplateError, r.URL.Path))
+}
+
+// INFO: componentRest returns the part of a request path below ComponentPath. ComponentPath is
+// a directory, e.g. "/_c" matches "/_c/card", but not "/_cart/".
+func (h *Handler) componentRest(p string) (string, bool) {
+	if h.ComponentPath == "" {
+		return "", false
+	}
+
+	prefix := FSPathToPath(PathToFSPath(h.ComponentPath))
+	if p+"/" == prefix {
+		return "", true
+	}
+
+	return strings.CutPrefix(p, prefix)
+}
+
+func (h *Handler) component(w http.ResponseWriter, r *http.Request, tree *routeTree, t *template.Template, route, name string) {
+	_, params, err := tree.match(route)
+	if err != nil {
+		h.Error(w, r, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		h.Error(w, r, NewHTTPError(http.StatusBadRequest, err))
+		return
+	}
+
+	data := map[string]any{}
+	for k, v := range params {
+		data[k] = v
+	}
+	for k, v := range r.Form {
+		if len(v) == 1 {
+			data[k] = v[0]
+		} else {
+			data[k] = v
+		}
+	}
+
+	if h.Live != nil {
+		b := h.Live.bind(r, t)
+		t.Funcs(b.funcs())
+		defer func() { b.done(err) }()
+	}
+
+	html, err := executeComponent(t, name, data)
+	if err != nil {
+		h.fail(w, r, err, route, data)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
+// INFO: name is the name of a component, e.g. "forms/hx_input" or "_hx_clock" for a global.
+// Page templates are not components, they need the layout and the data of the page.
+func isEndpoint(name string, all bool) bool {
+	switch {
+	case name == TEMPLATE_BODY, name == TEMPLATE_HEAD, name == TEMPLATE_HEADERS, isErrorTemplate(name):
+		return false
+	case all:
+		return true
+	}
+
+	return strings.HasPrefix(strings.TrimPrefix(path.Base(name), TEMPLATE_GLOBAL_PREFIX), TEMPLATE_ENDPOINT_PREFIX)
+}
@@ -0,0 +1,101 @@
+package templating
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func componentHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	lr := NewLayoutRegistry(fstest.MapFS{
+		"default/root.tmpl": {Data: []byte(`<html><body>{{ block "body" . }}{{ end }}</body></html>`)},
+	})
+	tr := NewTemplateRegistry(fstest.MapFS{
+		"body.tmpl":                    {Data: []byte(`root`)},
+		"_cart/body.tmpl":              {Data: []byte(`cart`)},
+		"posts/body.tmpl":              {Data: []byte(`posts`)},
+		"posts/headers.tmpl":           {Data: []byte(`X-Posts: 1`)},
+		"posts/404.tmpl":               {Data: []byte(`no post`)},
+		"posts/components/hx_row.tmpl": {Data: []byte(`row {{ .id }}`)},
+		"posts/components/item.tmpl":   {Data: []byte(`item`)},
+	})
+
+	if err := lr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(lr, tr)
+	h.ComponentPath = "/_c"
+	return h
+}
+
+func TestServeComponent(t *testing.T) {
+	h := componentHandler(t)
+
+	tests := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/_c/posts/hx_row?id=3", http.StatusOK, "row 3"},
+		{"/_c/posts/item", http.StatusNotFound, ""},
+		{"/_c/posts/missing", http.StatusNotFound, ""},
+		{"/_c/posts/body", http.StatusNotFound, ""},
+		{"/_c", http.StatusNotFound, ""},
+		{"/_cart/", http.StatusOK, "<html><body>cart</body></html>"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != tt.code {
+			t.Errorf("GET %s: status %d, want %d", tt.path, rec.Code, tt.code)
+		}
+		if tt.want != "" && rec.Body.String() != tt.want {
+			t.Errorf("GET %s = %q, want %q", tt.path, rec.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestServeComponentExposeAll(t *testing.T) {
+	h := componentHandler(t)
+	h.ComponentExposeAll = true
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/_c/posts/hx_row", http.StatusOK},
+		{"/_c/posts/item", http.StatusOK},
+		{"/_c/posts/body", http.StatusNotFound},
+		{"/_c/posts/headers", http.StatusNotFound},
+		{"/_c/posts/404", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if rec.Code != tt.code {
+			t.Errorf("GET %s: status %d, want %d", tt.path, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestGetComponentError(t *testing.T) {
+	h := componentHandler(t)
+
+	_, err := h.Routes.Get("/posts/", "missing")
+	var ferr FSError[error]
+	if !errors.Is(err, NoTemplateError) || !errors.As(err, &ferr) || ferr.File != "/posts/missing" {
+		t.Errorf("Get = %v, want %v for /posts/missing", err, NoTemplateError)
+	}
+}
@@ -0,0 +1,82 @@
+package templating
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrorData is the dot of error page templates
+type ErrorData struct {
+	Status  int
+	Message string
+	Path    string
+	// INFO: Error is only set for client errors (4xx), e.g. the message of a HTTPError
+	// returned by a loader. Internal error messages are never passed to templates.
+	Error string
+}
+
+// INFO: renderError renders the nearest error page for the status code inside its layout.
+// It returns NoTemplateError if no route directory provides an error page.
+func (h *Handler) renderError(w http.ResponseWriter, r *http.Request, code int, err error) error {
+	tree, lerr := h.Routes.current()
+	if lerr != nil {
+		return lerr
+	}
+
+	route, ok := tree.errorRoute(r.URL.Path, code)
+	if !ok {
+		return NoTemplateError
+	}
+
+	name := tree.templates[route].Layout
+	if name == "" {
+		name = h.Layout
+	}
+
+	layout, lerr := h.Layouts.Get(name)
+	if lerr != nil {
+		return lerr
+	}
+
+	layout, lerr = layout.Clone()
+	if lerr != nil {
+		return lerr
+	}
+
+	lerr = h.Routes.addError(tree, route, code, layout)
+	if lerr != nil {
+		return lerr
+	}
+
+	data := ErrorData{
+		Status:  code,
+		Message: http.StatusText(code),
+		Path:    r.URL.Path,
+	}
+
+	if code < http.StatusInternalServerError {
+		var herr HTTPError
+		if errors.As(err, &herr) && herr.Err != nil {
+			data.Error = herr.Err.Error()
+		}
+	}
+
+	buffer := h.buffer()
+	defer h.buffers.Put(buffer)
+
+	if IsPartial(r) {
+		lerr = layout.ExecuteTemplate(buffer, TEMPLATE_BODY, data)
+	} else {
+		lerr = execute(buffer, layout, data)
+	}
+
+	if lerr != nil {
+		return lerr
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	buffer.WriteTo(w)
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package templating
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestErrorRouteSkipsBrokenRoutes(t *testing.T) {
+	lr := NewLayoutRegistry(fstest.MapFS{
+		"default/root.tmpl": {Data: []byte(`<html><body>{{ block "body" . }}{{ end }}</body></html>`)},
+	})
+	tr := NewTemplateRegistry(fstest.MapFS{
+		"body.tmpl":       {Data: []byte(`root`)},
+		"404.tmpl":        {Data: []byte(`root not found`)},
+		"posts/body.tmpl": {Data: []byte(`{{ if }}`)},
+		"posts/404.tmpl":  {Data: []byte(`post not found`)},
+	})
+
+	if err := lr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Parse(); err == nil {
+		t.Fatal("expected posts/body.tmpl to be broken")
+	}
+
+	route, ok := tr.ErrorRoute("/posts/missing", http.StatusNotFound)
+	if !ok || route != "/" {
+		t.Fatalf("ErrorRoute = %q, %v, want /, true", route, ok)
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(lr, tr).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/posts/missing", nil))
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "root not found") {
+		t.Errorf("GET /posts/missing: status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -1,11 +1,30 @@
 package templating
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
 
 var InvalidPathError = errors.New("Invalid path. Must be a directory.")
 var NoTemplateError = errors.New("No template found for this name")
 var InvalidTemplateError = errors.New("invalid template")
 var FileAccessError = errors.New("could not stat file or directory")
+var InvalidLayoutError = errors.New("invalid layout: nesting forms a cycle")
+var InvalidHeaderError = errors.New("invalid line in headers template")
+var UndefinedFuncError = errors.New("template uses a function that is not registered, see RegisterFuncs")
+var TemplateCollisionError = errors.New("templates share a name")
+var NoComponentContextError = errors.New("components can only be rendered as part of a page")
+var InvalidComponentArgError = errors.New("component arguments must be props (dict) or slots (slot)")
+var NoEntryError = errors.New("entry point not found in the vite manifest")
+var InvalidDevServerError = errors.New("invalid vite dev server URL, expected e.g. http://localhost:5173")
+var NoLiveContextError = errors.New("live components can only be rendered by a Handler with Live set")
+var NoControllerError = errors.New("no live controller registered for this name")
+var InvalidTokenError = errors.New("invalid live component token")
+var NoInstanceError = errors.New("live component expired or unknown")
 
 type FSError[T error] struct {
 	File string
@@ -19,3 +38,132 @@ func NewError[T error](t T, file string) FSError[T] {
 func (e FSError[T]) Error() string {
 	return e.Err.Error() + ": " + e.File
 }
+
+func (e FSError[T]) Unwrap() error {
+	return e.Err
+}
+
+// ParseError describes a template file that could not be read or parsed.
+// errors.Is(err, InvalidTemplateError) reports whether a template is broken,
+// errors.As gives access to the underlying html/template error.
+type ParseError struct {
+	// INFO: FS path of the template file
+	File   string
+	Line   int
+	Column int
+	// INFO: Name of the template as registered, i.e. without extension
+	Name string
+	// INFO: URL path of the route or layout directory the template was read for
+	Route string
+	// INFO: The directories whose templates are merged into the template set, from the root down to
+	// Route, e.g. ["/", "/posts/"]. A broken global component shows up in every route that pulls it in.
+	Contexts []string
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.File)
+	if e.Line > 0 {
+		b.WriteString(":" + strconv.Itoa(e.Line))
+	}
+	if e.Column > 0 {
+		b.WriteString(":" + strconv.Itoa(e.Column))
+	}
+
+	fmt.Fprintf(&b, ": template %q", e.Name)
+	if e.Route != "" {
+		fmt.Fprintf(&b, " in %s", e.Route)
+	}
+	if len(e.Contexts) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(e.Contexts, ", "))
+	}
+
+	b.WriteString(": " + e.Err.Error())
+	return b.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParseError) Is(target error) bool {
+	return target == InvalidTemplateError && !errors.Is(e.Err, FileAccessError)
+}
+
+// INFO: html/template and text/template prefix their errors with "template: name:line:" or
+// "html/template:name:line:col:", which is the only place they report positions for all errors
+var errorPosition = regexp.MustCompile(`template: ?([^:]*):(\d+)(?::(\d+))?:`)
+
+// INFO: position extracts the template name, line and column from a html/template error message
+func position(err error) (string, int, int, bool) {
+	m := errorPosition.FindStringSubmatch(err.Error())
+	if m == nil {
+		return "", 0, 0, false
+	}
+
+	line, _ := strconv.Atoi(m[2])
+	column, _ := strconv.Atoi(m[3])
+	return m[1], line, column, true
+}
+
+func newParseError(file, name string, err error) *ParseError {
+	perr := &ParseError{File: file, Name: name, Err: err}
+	_, perr.Line, perr.Column, _ = position(err)
+	return perr
+}
+
+// ParseErrors collects all errors found while parsing a registry
+type ParseErrors []error
+
+func (e ParseErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+
+	return "broken templates:\n" + strings.Join(lines, "\n")
+}
+
+func (e ParseErrors) Unwrap() []error {
+	return e
+}
+
+// INFO: HTTPError can be returned by loaders to control the status code of the response
+type HTTPError struct {
+	Code int
+	Err  error
+}
+
+func NewHTTPError(code int, err error) HTTPError {
+	return HTTPError{Code: code, Err: err}
+}
+
+func (e HTTPError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Code)
+	}
+	return http.StatusText(e.Code) + ": " + e.Err.Error()
+}
+
+func (e HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode maps an error returned by the registries or a loader to a HTTP status code
+func StatusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+
+	var herr HTTPError
+	if errors.As(err, &herr) {
+		return herr.Code
+	}
+
+	if errors.Is(err, NoTemplateError) || errors.Is(err, InvalidPathError) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
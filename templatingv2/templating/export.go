@@ -0,0 +1,322 @@
+package templating
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template/parse"
+)
+
+// INFO: the file a route is written to inside its directory, so plain file servers serve it for the directory URL
+const EXPORT_INDEX_FILE = "index.html"
+
+// INFO: the 404 page of the root directory is written here, most static hosts serve it for missing files
+const EXPORT_NOT_FOUND_FILE = "404.html"
+
+var exportLink = regexp.MustCompile(`(?i)\s(?:href|src)\s*=\s*["']([^"']*)["']`)
+
+// Exporter renders the routes of a Handler into a directory of static HTML files, e.g. for marketing
+// pages hosted on plain file servers. Only routes that need no data can be exported: dynamic routes
+// and routes with a loader are skipped.
+type Exporter struct {
+	Handler *Handler
+	// INFO: If set, the static assets are copied to the directory as well, see Assets.Export
+	Assets *Assets
+}
+
+// ExportReport lists the outcome of an export. Errors and broken links do not stop an export,
+// every route is rendered and reported.
+type ExportReport struct {
+	// INFO: routing paths of all pages written
+	Pages []string
+	// INFO: routing paths of dynamic routes and routes with a loader
+	Skipped []string
+	// INFO: errors of routes that could not be rendered, keyed by routing path
+	Errors map[string]error
+	Broken []BrokenLink
+}
+
+// BrokenLink is an internal link on an exported page, pointing to neither a page nor a file of the export
+type BrokenLink struct {
+	Page string
+	Href string
+}
+
+func (l BrokenLink) String() string {
+	return l.Page + ": " + l.Href
+}
+
+func NewExporter(handler *Handler, assets *Assets) *Exporter {
+	return &Exporter{
+		Handler: handler,
+		Assets:  assets,
+	}
+}
+
+// OK reports whether all routes were exported without errors and broken links
+func (r *ExportReport) OK() bool {
+	return len(r.Errors) == 0 && len(r.Broken) == 0
+}
+
+func (r *ExportReport) String() string {
+	var b strings.Builder
+	for _, route := range slices.Sorted(maps.Keys(r.Errors)) {
+		fmt.Fprintf(&b, "%s: %v\n", route, r.Errors[route])
+	}
+	for _, link := range r.Broken {
+		fmt.Fprintf(&b, "broken link %s\n", link)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Export writes every exportable route to dir/<route>/index.html, using the same rendering as the
+// Handler, including layouts and headers. Pages are rendered without the reload script and debug page.
+// The returned error is only set if the directory could not be written, see ExportReport for the rest.
+func (e *Exporter) Export(dir string) (*ExportReport, error) {
+	report := &ExportReport{
+		Pages:   []string{},
+		Skipped: []string{},
+		Errors:  make(map[string]error),
+		Broken:  []BrokenLink{},
+	}
+
+	// INFO: we render with a copy, so the export never changes how the original Handler serves
+	h := NewHandler(e.Handler.Layouts, e.Handler.Routes)
+	h.Layout = e.Handler.Layout
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return report, err
+	}
+
+	if e.Assets != nil {
+		err = e.Assets.Export(filepath.Join(dir, filepath.FromSlash(PathToFSPath(e.Assets.Prefix))))
+		if err != nil {
+			return report, err
+		}
+	}
+
+	for route, err := range h.Routes.Broken() {
+		report.Errors[route] = err
+	}
+
+	pages := make(map[string][]byte)
+	for _, route := range h.Routes.Routes() {
+		if _, ok := report.Errors[route]; ok {
+			continue
+		}
+
+		if IsDynamicPath(route) || h.Routes.HasLoader(route) {
+			report.Skipped = append(report.Skipped, route)
+			continue
+		}
+
+		// INFO: live components only work with the server that rendered them, static pages can not have them
+		if live, err := h.UsesLive(route); err == nil && live {
+			report.Skipped = append(report.Skipped, route)
+			continue
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, route, nil))
+
+		page := rec.Body.Bytes()
+		// INFO: file servers can not send redirects, the page redirects instead
+		if location := rec.Header().Get("Location"); isRedirect(rec.Code) && location != "" {
+			page = redirectPage(location)
+		} else if rec.Code != http.StatusOK {
+			report.Errors[route] = NewHTTPError(rec.Code, nil)
+			continue
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(PathToFSPath(route)), EXPORT_INDEX_FILE)
+		err := writeFile(file, page)
+		if err != nil {
+			return report, err
+		}
+
+		pages[route] = page
+		report.Pages = append(report.Pages, route)
+	}
+
+	if _, ok := h.Routes.ErrorRoute("/", http.StatusNotFound); ok {
+		rec := httptest.NewRecorder()
+		h.Error(rec, httptest.NewRequest(http.MethodGet, "/"+EXPORT_NOT_FOUND_FILE, nil), NewError(NoTemplateError, "/"))
+
+		err := writeFile(filepath.Join(dir, EXPORT_NOT_FOUND_FILE), rec.Body.Bytes())
+		if err != nil {
+			return report, err
+		}
+	}
+
+	for _, route := range report.Pages {
+		report.Broken = append(report.Broken, brokenLinks(dir, route, pages[route])...)
+	}
+
+	return report, nil
+}
+
+func redirectPage(location string) []byte {
+	location = html.EscapeString(location)
+	return []byte(`<!DOCTYPE html><html><head><meta http-equiv="refresh" content="0; url=` + location + `" /></head>` +
+		`<body><a href="` + location + `">` + location + `</a></body></html>`)
+}
+
+// INFO: brokenLinks checks all root relative and relative links of a page against the files of the export
+func brokenLinks(dir, route string, page []byte) []BrokenLink {
+	broken := []BrokenLink{}
+	seen := []string{}
+
+	for _, match := range exportLink.FindAllSubmatch(page, -1) {
+		href := string(match[1])
+		u, err := url.Parse(href)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || slices.Contains(seen, u.Path) {
+			continue
+		}
+		seen = append(seen, u.Path)
+
+		p := u.Path
+		if !strings.HasPrefix(p, "/") {
+			p = path.Join(route, p)
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(PathToFSPath(path.Clean(p))))
+		info, err := os.Stat(file)
+		if err == nil && info.IsDir() {
+			_, err = os.Stat(filepath.Join(file, EXPORT_INDEX_FILE))
+		}
+
+		if err != nil {
+			broken = append(broken, BrokenLink{Page: route, Href: href})
+		}
+	}
+
+	return broken
+}
+
+// Export copies all assets ServeHTTP serves to dir, each under its plain and its fingerprinted name, see URL
+func (a *Assets) Export(dir string) error {
+	return fs.WalkDir(a.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if name != "." && !public(name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := fs.ReadFile(a.fsys, name)
+		if err != nil {
+			return NewError(FileAccessError, name)
+		}
+
+		err = writeFile(filepath.Join(dir, filepath.FromSlash(name)), data)
+		if err != nil {
+			return err
+		}
+
+		u, err := a.URL(name)
+		if err != nil {
+			return err
+		}
+
+		fingerprinted := strings.TrimPrefix(u, a.Prefix)
+		if fingerprinted == name {
+			return nil
+		}
+
+		return writeFile(filepath.Join(dir, filepath.FromSlash(fingerprinted)), data)
+	})
+}
+
+func writeFile(file string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(file), 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(file, data, 0o644)
+	if err != nil {
+		return errors.Join(NewError(FileAccessError, file), err)
+	}
+
+	return nil
+}
+
+// INFO: usesFuncs reports whether any template of t calls one of the funcs, executed or not
+func usesFuncs(t *template.Template, funcs []string) bool {
+	for _, st := range t.Templates() {
+		if st.Tree != nil && usesFuncsNode(st.Tree.Root, funcs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func usesFuncsNode(node parse.Node, funcs []string) bool {
+	switch n := node.(type) {
+	case *parse.IdentifierNode:
+		return slices.Contains(funcs, n.Ident)
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if usesFuncsNode(child, funcs) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesFuncsNode(n.Pipe, funcs)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if usesFuncsNode(cmd, funcs) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if usesFuncsNode(arg, funcs) {
+				return true
+			}
+		}
+	case *parse.ChainNode:
+		return usesFuncsNode(n.Node, funcs)
+	case *parse.TemplateNode:
+		return usesFuncsNode(n.Pipe, funcs)
+	case *parse.IfNode:
+		return usesFuncsNode(&n.BranchNode, funcs)
+	case *parse.RangeNode:
+		return usesFuncsNode(&n.BranchNode, funcs)
+	case *parse.WithNode:
+		return usesFuncsNode(&n.BranchNode, funcs)
+	case *parse.BranchNode:
+		return usesFuncsNode(n.Pipe, funcs) || usesFuncsNode(n.List, funcs) || usesFuncsNode(n.ElseList, funcs)
+	}
+
+	return false
+}
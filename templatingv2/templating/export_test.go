@@ -0,0 +1,34 @@
+package templating
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestUsesFuncs(t *testing.T) {
+	funcs := template.FuncMap{"live": func(string, ...any) string { return "" }, "upper": func(s string) string { return s }}
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{`plain`, false},
+		{`{{ upper "x" }}`, false},
+		{`{{ live "counter" . }}`, true},
+		{`{{ if . }}{{ else }}{{ with . }}{{ live "counter" }}{{ end }}{{ end }}`, true},
+		{`{{ range . }}{{ upper (live "counter") }}{{ end }}`, true},
+		{`{{ define "other" }}{{ live "counter" }}{{ end }}`, true},
+		{`{{ template "x" (live "counter") }}{{ define "x" }}{{ end }}`, true},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := template.New("test").Funcs(funcs).Parse(tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := usesFuncs(tmpl, LIVE_FUNCS); got != tt.want {
+			t.Errorf("usesFuncs(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package funcs is an opt-in library of template functions for the registries:
+//
+//	tr.RegisterFuncs(funcs.Standard())
+//	lr.RegisterFuncs(funcs.Standard())
+//
+// All functions return plain values, so html/template escapes their results for the
+// context they are used in. Only query and link return template.URL, since their output
+// is built from escaped parts.
+package funcs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var OddArgumentsError = errors.New("expected an even number of key value arguments")
+var InvalidKeyError = errors.New("keys must be strings")
+
+func Standard() template.FuncMap {
+	return template.FuncMap{
+		// INFO: construction, e.g. {{ template "card" (dict "title" .Title "items" (list 1 2 3)) }}
+		"dict": Dict,
+		"list": List,
+
+		"default": Default,
+
+		"upper":     strings.ToUpper,
+		"lower":     strings.ToLower,
+		"title":     Title,
+		"trim":      strings.TrimSpace,
+		"truncate":  Truncate,
+		"replace":   Replace,
+		"contains":  Contains,
+		"hasPrefix": HasPrefix,
+		"hasSuffix": HasSuffix,
+		"split":     Split,
+		"join":      Join,
+
+		"add":    Add,
+		"sub":    Sub,
+		"number": Number,
+
+		"now":  time.Now,
+		"date": Date,
+
+		// INFO: e.g. <div x-data="{{ json .State }}">, the attribute escaping is undone by the browser
+		"json": JSON,
+
+		"query": Query,
+		"link":  Link,
+	}
+}
+
+// INFO: Arguments in pipelines are passed last, so the value is the last parameter of all functions:
+// {{ .Name | default "Anonymous" }}, {{ .Text | truncate 20 }}
+
+func Dict(kv ...any) (map[string]any, error) {
+	if len(kv)%2 != 0 {
+		return nil, OddArgumentsError
+	}
+
+	dict := make(map[string]any, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v", InvalidKeyError, kv[i])
+		}
+		dict[key] = kv[i+1]
+	}
+
+	return dict, nil
+}
+
+func List(items ...any) []any {
+	return items
+}
+
+// Default returns def if v is empty, i.e. nil, false, 0, "" or an empty collection
+func Default(def, v any) any {
+	if empty(v) {
+		return def
+	}
+	return v
+}
+
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+// Title upper cases the first letter of every word
+func Title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// Truncate shortens s to n runes, ending with an ellipsis if anything was cut off
+func Truncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+
+	if n == 0 {
+		return ""
+	}
+
+	return string(runes[:n-1]) + "…"
+}
+
+func Replace(old, new, s string) string {
+	return strings.ReplaceAll(s, old, new)
+}
+
+func Contains(sub, s string) bool {
+	return strings.Contains(s, sub)
+}
+
+func HasPrefix(prefix, s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+func HasSuffix(suffix, s string) bool {
+	return strings.HasSuffix(s, suffix)
+}
+
+func Split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
+
+// Join joins the elements of a slice of any type, formatted with fmt
+func Join(sep string, list any) (string, error) {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a slice, got %T", list)
+	}
+
+	elems := make([]string, rv.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+
+	return strings.Join(elems, sep), nil
+}
+
+func Add(a, b int) int {
+	return a + b
+}
+
+func Sub(a, b int) int {
+	return a - b
+}
+
+// Number formats any integer or float with the given number of decimals and thousands separators,
+// e.g. {{ number 2 1234.5 }} renders 1,234.50
+func Number(decimals int, v any) (string, error) {
+	var f float64
+	switch n := v.(type) {
+	case int:
+		f = float64(n)
+	case int32:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case uint:
+		f = float64(n)
+	case uint64:
+		f = float64(n)
+	case float32:
+		f = float64(n)
+	case float64:
+		f = n
+	case string:
+		parsed, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return "", err
+		}
+		f = parsed
+	default:
+		return "", fmt.Errorf("number: expected a number, got %T", v)
+	}
+
+	s := strconv.FormatFloat(f, 'f', decimals, 64)
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign = "-"
+		s = s[1:]
+	}
+
+	integer, fraction, hasfraction := strings.Cut(s, ".")
+
+	var b strings.Builder
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteRune(',')
+		}
+		b.WriteRune(r)
+	}
+
+	if hasfraction {
+		return sign + b.String() + "." + fraction, nil
+	}
+
+	return sign + b.String(), nil
+}
+
+// Date formats a time.Time, a RFC 3339 string or unix seconds with a Go time layout,
+// e.g. {{ date "02.01.2006" .Created }}
+func Date(layout string, v any) (string, error) {
+	var t time.Time
+	switch d := v.(type) {
+	case time.Time:
+		t = d
+	case *time.Time:
+		if d == nil {
+			return "", nil
+		}
+		t = *d
+	case string:
+		parsed, err := time.Parse(time.RFC3339, d)
+		if err != nil {
+			return "", err
+		}
+		t = parsed
+	case int:
+		t = time.Unix(int64(d), 0)
+	case int64:
+		t = time.Unix(d, 0)
+	default:
+		return "", fmt.Errorf("date: expected a time, got %T", v)
+	}
+
+	return t.Format(layout), nil
+}
+
+func JSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Query encodes key value pairs as a URL query, e.g. {{ query "page" 2 "q" .Search }} renders page=2&q=...
+func Query(kv ...any) (template.URL, error) {
+	values, err := queryValues(kv)
+	if err != nil {
+		return "", err
+	}
+	return template.URL(values.Encode()), nil
+}
+
+// Link builds a URL from a path and key value pairs for its query, e.g. {{ link "/posts/" "page" 2 }}.
+// Paths with a scheme other than http, https or mailto are replaced, like html/template does for unsafe URLs.
+func Link(path string, kv ...any) (template.URL, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto" {
+		return "#ZgotmplZ", nil
+	}
+
+	values, err := queryValues(kv)
+	if err != nil {
+		return "", err
+	}
+
+	if len(values) > 0 {
+		q := u.Query()
+		for k, vs := range values {
+			for _, v := range vs {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return template.URL(u.String()), nil
+}
+
+func queryValues(kv []any) (url.Values, error) {
+	if len(kv)%2 != 0 {
+		return nil, OddArgumentsError
+	}
+
+	values := url.Values{}
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v", InvalidKeyError, kv[i])
+		}
+		values.Add(key, fmt.Sprint(kv[i+1]))
+	}
+
+	return values, nil
+}
@@ -0,0 +1,258 @@
+package funcs
+
+import (
+	"errors"
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDict(t *testing.T) {
+	tests := []struct {
+		name string
+		kv   []any
+		want map[string]any
+		err  error
+	}{
+		{"empty", nil, map[string]any{}, nil},
+		{"pairs", []any{"a", 1, "b", "x"}, map[string]any{"a": 1, "b": "x"}, nil},
+		{"odd", []any{"a"}, nil, OddArgumentsError},
+		{"key", []any{1, "a"}, nil, InvalidKeyError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Dict(tt.kv...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Dict(%v) error = %v, want %v", tt.kv, err, tt.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dict(%v) = %v, want %v", tt.kv, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	var nilptr *int
+	one := 1
+
+	tests := []struct {
+		name string
+		v    any
+		want any
+	}{
+		{"nil", nil, "def"},
+		{"empty string", "", "def"},
+		{"string", "x", "x"},
+		{"zero", 0, "def"},
+		{"int", 3, 3},
+		{"false", false, "def"},
+		{"true", true, true},
+		{"empty slice", []int{}, "def"},
+		{"slice", []int{1}, []int{1}},
+		{"empty map", map[string]int{}, "def"},
+		{"nil pointer", nilptr, "def"},
+		{"pointer", &one, &one},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Default("def", tt.v)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Default(def, %v) = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{5, "Hello", "Hello"},
+		{5, "Hello World", "Hell…"},
+		{3, "Grüße", "Gr…"},
+		{0, "Hello", ""},
+		{-1, "Hello", "Hello"},
+		{1, "Hello", "…"},
+	}
+
+	for _, tt := range tests {
+		got := Truncate(tt.n, tt.s)
+		if got != tt.want {
+			t.Errorf("Truncate(%d, %q) = %q, want %q", tt.n, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		decimals int
+		v        any
+		want     string
+		err      bool
+	}{
+		{0, 0, "0", false},
+		{0, 123, "123", false},
+		{0, 1234, "1,234", false},
+		{2, 1234.5, "1,234.50", false},
+		{0, int64(-1234567), "-1,234,567", false},
+		{1, float32(0.25), "0.2", false},
+		{0, uint(1000000), "1,000,000", false},
+		{2, "999.999", "1,000.00", false},
+		{0, "abc", "", true},
+		{0, true, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := Number(tt.decimals, tt.v)
+		if (err != nil) != tt.err {
+			t.Fatalf("Number(%d, %v) error = %v, want error %v", tt.decimals, tt.v, err, tt.err)
+		}
+		if got != tt.want {
+			t.Errorf("Number(%d, %v) = %q, want %q", tt.decimals, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	ts := time.Date(2024, 10, 3, 14, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		v    any
+		want string
+		err  bool
+	}{
+		{"time", ts, "03.10.2024 14:05", false},
+		{"pointer", &ts, "03.10.2024 14:05", false},
+		{"nil pointer", (*time.Time)(nil), "", false},
+		{"rfc3339", "2024-10-03T14:05:00Z", "03.10.2024 14:05", false},
+		{"unix", int64(ts.Unix()), ts.Local().Format("02.01.2006 15:04"), false},
+		{"invalid string", "yesterday", "", true},
+		{"invalid type", 1.5, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Date("02.01.2006 15:04", tt.v)
+			if (err != nil) != tt.err {
+				t.Fatalf("Date(%v) error = %v, want error %v", tt.v, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Date(%v) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		path string
+		kv   []any
+		want template.URL
+	}{
+		{"/posts/", nil, "/posts/"},
+		{"/posts/", []any{"page", 2}, "/posts/?page=2"},
+		{"/posts/?sort=new", []any{"page", 2}, "/posts/?page=2&sort=new"},
+		{"/search", []any{"q", "a&b c"}, "/search?q=a%26b+c"},
+		{"https://example.com/x", nil, "https://example.com/x"},
+		{"mailto:a@example.com", nil, "mailto:a@example.com"},
+		{"javascript:alert(1)", nil, "#ZgotmplZ"},
+		{"JavaScript:alert(1)", nil, "#ZgotmplZ"},
+	}
+
+	for _, tt := range tests {
+		got, err := Link(tt.path, tt.kv...)
+		if err != nil {
+			t.Fatalf("Link(%q, %v) error = %v", tt.path, tt.kv, err)
+		}
+		if got != tt.want {
+			t.Errorf("Link(%q, %v) = %q, want %q", tt.path, tt.kv, got, tt.want)
+		}
+	}
+}
+
+// INFO: the funcs are only useful if html/template escapes their results correctly in every context
+func TestEscaping(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl string
+		data any
+		want string
+	}{
+		{
+			"json in attribute",
+			`<div x-data="{{ json . }}"></div>`,
+			map[string]any{"q": `"><script>alert(1)</script>`},
+			`<div x-data="{&#34;q&#34;:&#34;\&#34;\u003e\u003cscript\u003ealert(1)\u003c/script\u003e&#34;}"></div>`,
+		},
+		{
+			// INFO: json returns a string, so in scripts it is a string literal for JSON.parse
+			"json in script",
+			`<script>let state = {{ json . }};</script>`,
+			map[string]any{"q": `</script>`},
+			`<script>let state = "{\"q\":\"\\u003c/script\\u003e\"}";</script>`,
+		},
+		{
+			"unsafe link",
+			`<a href="{{ link . }}">x</a>`,
+			"javascript:alert(1)",
+			`<a href="#ZgotmplZ">x</a>`,
+		},
+		{
+			"link with query",
+			`<a href="{{ link "/search" "q" . }}">x</a>`,
+			`a&b"c`,
+			`<a href="/search?q=a%26b%22c">x</a>`,
+		},
+		{
+			"query with ampersand",
+			`<a href="/search?{{ query "q" . "page" 2 }}">x</a>`,
+			"a&b=c",
+			`<a href="/search?page=2&amp;q=a%26b%3Dc">x</a>`,
+		},
+		{
+			"query in text",
+			`<p>{{ query "q" . }}</p>`,
+			"<b>",
+			`<p>q=%3Cb%3E</p>`,
+		},
+		{
+			"truncate in text",
+			`<p>{{ . | truncate 4 }}</p>`,
+			"<b>bold</b>",
+			`<p>&lt;b&gt;…</p>`,
+		},
+		{
+			"default in attribute",
+			`<input value="{{ . | default "x\"y" }}">`,
+			"",
+			`<input value="x&#34;y">`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("test").Funcs(Standard()).Parse(tt.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b strings.Builder
+			err = tmpl.Execute(&b, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if b.String() != tt.want {
+				t.Errorf("got  %s\nwant %s", b.String(), tt.want)
+			}
+		})
+	}
+}
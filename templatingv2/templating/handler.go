@@ -0,0 +1,267 @@
+package templating
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Handler serves the routes of a TemplateRegistry inside the layouts of a LayoutRegistry
+type Handler struct {
+	Layouts *LayoutRegistry
+	Routes  *TemplateRegistry
+	// INFO: Name of the layout used for routes without a layout file
+	Layout string
+	// INFO: If set, the reload script is injected into every page, see Reloader
+	Reloader *Reloader
+	// INFO: If set, pages can render live components and the live script is injected, see Live
+	Live *Live
+	// INFO: If set, the components of all routes are served on their own below this path, see ServeComponent
+	ComponentPath string
+	// INFO: If set, all components are served below ComponentPath, not only those named with TEMPLATE_ENDPOINT_PREFIX.
+	// The page templates of a route, like body, headers and error pages, are never served on their own.
+	ComponentExposeAll bool
+	// INFO: If set, server errors render a debug page with template source and data. Never use this in production.
+	Debug   bool
+	buffers sync.Pool
+}
+
+func NewHandler(layouts *LayoutRegistry, routes *TemplateRegistry) *Handler {
+	return &Handler{
+		Layouts: layouts,
+		Routes:  routes,
+		Layout:  TEMPLATE_DEFAULT_LAYOUT,
+		buffers: sync.Pool{
+			New: func() any {
+				return new(bytes.Buffer)
+			},
+		},
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.componentRest(r.URL.Path); ok {
+		h.ServeComponent(w, r)
+		return
+	}
+
+	// INFO: a request uses the same route tree throughout, even if the routes are parsed again meanwhile
+	tree, err := h.Routes.current()
+	if err != nil {
+		h.Error(w, r, err)
+		return
+	}
+
+	route, params, err := tree.match(r.URL.Path)
+	if err != nil {
+		h.Error(w, r, err)
+		return
+	}
+
+	data, err := h.Routes.Data(r, route, params)
+	if err != nil {
+		h.fail(w, r, err, route, nil)
+		return
+	}
+
+	layout, err := h.page(tree, route)
+	if err != nil {
+		h.fail(w, r, err, route, data)
+		return
+	}
+
+	if h.Live != nil {
+		b := h.Live.bind(r, layout)
+		layout.Funcs(b.funcs())
+		// INFO: err is the last error of the request, e.g. of the render below
+		defer func() { b.done(err) }()
+	}
+
+	// INFO: headers are rendered before the body, so redirects do not need to render the body at all
+	header := http.Header{}
+	status := http.StatusOK
+	if layout.Lookup(TEMPLATE_HEADERS) != nil {
+		header, status, err = renderHeaders(layout, data)
+		if err != nil {
+			h.fail(w, r, err, route, data)
+			return
+		}
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if isRedirect(status) && header.Get("Location") != "" {
+			copyHeader(w.Header(), header)
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	buffer := h.buffer()
+	defer h.buffers.Put(buffer)
+
+	partial := IsPartial(r)
+	if partial {
+		err = renderPartial(buffer, r, layout, data)
+	} else {
+		err = execute(buffer, layout, data)
+	}
+
+	if err != nil {
+		h.fail(w, r, err, route, data)
+		return
+	}
+
+	if h.Reloader != nil && !partial {
+		inject(buffer, h.Reloader.Script())
+	}
+
+	if h.Live != nil && !partial {
+		inject(buffer, h.Live.Script())
+	}
+
+	// INFO: the same URL renders differently for htmx requests, caches must respect that
+	w.Header().Add("Vary", "HX-Request, HX-Target")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// INFO: headers from the headers template are applied last, so they may overwrite the defaults above
+	copyHeader(w.Header(), header)
+	w.WriteHeader(status)
+	buffer.WriteTo(w)
+}
+
+// INFO: page returns the layout of a route with the route templates of tree added, ready for execution
+func (h *Handler) page(tree *routeTree, route string) (*template.Template, error) {
+	name := tree.templates[route].Layout
+	if name == "" {
+		name = h.Layout
+	}
+
+	layout, err := h.Layouts.Get(name)
+	if err != nil {
+		// INFO: a missing layout is a misconfiguration, not a missing page
+		return nil, NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// INFO: we clone the layout here, since templates can not be added to after execution
+	layout, err = layout.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.Routes.add(tree, route, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	return layout, nil
+}
+
+// Render writes the full page of a request path with the given data, bypassing loaders,
+// headers and htmx partials, e.g. for previews and tooling. If data is nil, the route params are used.
+func (h *Handler) Render(w io.Writer, path string, data any) error {
+	tree, err := h.Routes.current()
+	if err != nil {
+		return err
+	}
+
+	route, params, err := tree.match(path)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		data = params
+	}
+
+	layout, err := h.page(tree, route)
+	if err != nil {
+		return err
+	}
+
+	return execute(w, layout, data)
+}
+
+// INFO: buffer returns an empty buffer from the pool. A Handler built as a struct literal
+// has a pool without New, so we allocate the buffer ourselves.
+func (h *Handler) buffer() *bytes.Buffer {
+	buffer, ok := h.buffers.Get().(*bytes.Buffer)
+	if !ok {
+		return new(bytes.Buffer)
+	}
+
+	buffer.Reset()
+	return buffer
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		dst.Del(k)
+		for _, v := range vs {
+			dst.Add(k, v)
+		}
+	}
+}
+
+// Error writes an error response with the status code matching err: missing routes are 404s,
+// parse and execution errors are 500s. The nearest error page of the route tree is rendered,
+// see ErrorRoute, falling back to plain text. Internal error messages are logged, but not sent to the client.
+func (h *Handler) Error(w http.ResponseWriter, r *http.Request, err error) {
+	h.fail(w, r, err, "", nil)
+}
+
+// INFO: fail is Error with the matched route and its data, if known, for the debug page
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, err error, route string, data any) {
+	code := StatusCode(err)
+	logError(r, code, err)
+	if code >= http.StatusInternalServerError {
+		if h.Debug {
+			h.renderDebug(w, r, code, err, route, data)
+			return
+		}
+	}
+
+	perr := h.renderError(w, r, code, err)
+	if perr != nil {
+		if !errors.Is(perr, NoTemplateError) {
+			log.Printf("templating: %s %s: could not render error page: %v", r.Method, r.URL.Path, perr)
+		}
+
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// INFO: logError logs server errors. Client errors, e.g. missing pages, are expected and not logged.
+func logError(r *http.Request, code int, err error) {
+	if code >= http.StatusInternalServerError {
+		log.Printf("templating: %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// INFO: layouts are executed by their root template, falling back to the first parsed template
+func execute(w io.Writer, t *template.Template, data any) error {
+	if t.Lookup(TEMPLATE_ROOT_NAME) != nil {
+		return t.ExecuteTemplate(w, TEMPLATE_ROOT_NAME, data)
+	}
+
+	return t.Execute(w, data)
+}
+
+// INFO: inject inserts html before the closing body tag, or appends it if there is none
+func inject(buffer *bytes.Buffer, html string) {
+	b := buffer.Bytes()
+	i := bytes.LastIndex(b, []byte("</body>"))
+	if i == -1 {
+		buffer.WriteString(html)
+		return
+	}
+
+	tail := bytes.Clone(b[i:])
+	buffer.Truncate(i)
+	buffer.WriteString(html)
+	buffer.Write(tail)
+}
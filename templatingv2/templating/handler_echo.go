@@ -0,0 +1,11 @@
+package templating
+
+import "github.com/labstack/echo/v4"
+
+// Echo adapts the Handler to an echo route, e.g. e.GET("/*", h.Echo())
+func (h *Handler) Echo() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		h.ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
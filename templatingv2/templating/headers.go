@@ -0,0 +1,199 @@
+package templating
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// INFO: name of the func checking every value written by the headers template, see escapeHeaders
+const TEMPLATE_HEADERS_ESCAPER = "_headers_value"
+
+// INFO: The headers template renders one "Key: Value" header per line, blank lines are ignored.
+// The pseudo header "Status: 404" sets the status code of the response. A Location header
+// without a status redirects with 302 Found.
+func renderHeaders(t *template.Template, data any) (http.Header, int, error) {
+	var buffer bytes.Buffer
+
+	err := escapeHeaders(t)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = t.ExecuteTemplate(&buffer, TEMPLATE_HEADERS, data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header, status, err := parseHeaders(buffer.String())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if status == 0 && header.Get("Location") != "" {
+		status = http.StatusFound
+	}
+
+	return header, status, nil
+}
+
+func parseHeaders(text string) (http.Header, int, error) {
+	header := http.Header{}
+	status := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		// INFO: the headers template is a html template, so values are html escaped on execution
+		line := strings.TrimSpace(html.UnescapeString(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, 0, fmt.Errorf("%w: %q", InvalidHeaderError, line)
+		}
+
+		if strings.EqualFold(key, "Status") {
+			code, err := strconv.Atoi(value)
+			if err != nil || code < 100 || code > 999 {
+				return nil, 0, fmt.Errorf("%w: %q", InvalidHeaderError, line)
+			}
+
+			status = code
+			continue
+		}
+
+		header.Add(key, value)
+	}
+
+	// INFO: lines longer than the scanner buffer would silently drop the rest of the headers
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", InvalidHeaderError, err)
+	}
+
+	return header, status, nil
+}
+
+// INFO: html/template does not escape line breaks, so a value like "x\nLocation: //evil.example" would
+// add a header of its own. escapeHeaders appends TEMPLATE_HEADERS_ESCAPER to every action of the
+// headers template before it is executed, html/template adds its own escaper after it.
+// t must not have been executed yet, like the page clones of the Handler.
+func escapeHeaders(t *template.Template) error {
+	t.Funcs(template.FuncMap{TEMPLATE_HEADERS_ESCAPER: headersValue})
+	return escapeHeadersTemplate(t, TEMPLATE_HEADERS, TEMPLATE_HEADERS, map[string]bool{})
+}
+
+// INFO: templates called from the headers template are escaped as copies named as, since the body may call them too
+func escapeHeadersTemplate(t *template.Template, name, as string, seen map[string]bool) error {
+	if seen[as] {
+		return nil
+	}
+	seen[as] = true
+
+	st := t.Lookup(name)
+	if st == nil || st.Tree == nil {
+		// INFO: execution reports the missing template
+		return nil
+	}
+
+	tree := st.Tree.Copy()
+	err := escapeHeadersNode(t, tree.Root, seen)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.AddParseTree(as, tree)
+	return err
+}
+
+func escapeHeadersNode(t *template.Template, node parse.Node, seen map[string]bool) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, c := range n.Nodes {
+			err := escapeHeadersNode(t, c, seen)
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		// INFO: variable declarations write nothing
+		if len(n.Pipe.Decl) != 0 {
+			return nil
+		}
+
+		cmd := &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(TEMPLATE_HEADERS_ESCAPER).SetPos(n.Pos)},
+		}
+
+		// INFO: html/template only allows its predefined escapers at the end of a pipeline
+		cmds := n.Pipe.Cmds
+		i := len(cmds)
+		if i > 0 && isPredefinedEscaper(cmds[i-1]) {
+			i--
+		}
+		n.Pipe.Cmds = append(cmds[:i:i], append([]*parse.CommandNode{cmd}, cmds[i:]...)...)
+	case *parse.IfNode:
+		return escapeHeadersBranch(t, &n.BranchNode, seen)
+	case *parse.RangeNode:
+		return escapeHeadersBranch(t, &n.BranchNode, seen)
+	case *parse.WithNode:
+		return escapeHeadersBranch(t, &n.BranchNode, seen)
+	case *parse.TemplateNode:
+		as := TEMPLATE_HEADERS + ":" + n.Name
+		err := escapeHeadersTemplate(t, n.Name, as, seen)
+		if err != nil {
+			return err
+		}
+		n.Name = as
+	}
+
+	return nil
+}
+
+func escapeHeadersBranch(t *template.Template, n *parse.BranchNode, seen map[string]bool) error {
+	err := escapeHeadersNode(t, n.List, seen)
+	if err != nil {
+		return err
+	}
+
+	return escapeHeadersNode(t, n.ElseList, seen)
+}
+
+func isPredefinedEscaper(cmd *parse.CommandNode) bool {
+	if len(cmd.Args) == 0 {
+		return false
+	}
+
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && (ident.Ident == "html" || ident.Ident == "urlquery")
+}
+
+// INFO: headersValue rejects values with line breaks and passes all others on unchanged, so
+// html/template escapes them as before
+func headersValue(v any) (any, error) {
+	s := fmt.Sprint(v)
+	if strings.ContainsAny(s, "\r\n") {
+		return nil, fmt.Errorf("%w: value with a line break: %q", InvalidHeaderError, s)
+	}
+
+	return v, nil
+}
+
+func isRedirect(status int) bool {
+	return status >= 300 && status < 400
+}
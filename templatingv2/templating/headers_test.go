@@ -0,0 +1,133 @@
+package templating
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRenderHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		tmpl   string
+		data   any
+		want   http.Header
+		status int
+		err    error
+	}{
+		{
+			"values",
+			"X-Q: {{ .q }}\nX-Html: {{ .q | html }}\n",
+			map[string]any{"q": "a&b"},
+			http.Header{"X-Q": {"a&b"}, "X-Html": {"a&b"}},
+			0,
+			nil,
+		},
+		{
+			"redirect",
+			"Location: /posts/{{ .id }}/",
+			map[string]any{"id": "42"},
+			http.Header{"Location": {"/posts/42/"}},
+			http.StatusFound,
+			nil,
+		},
+		{
+			"range",
+			"{{ range .links }}Link: {{ . }}\n{{ end }}",
+			map[string]any{"links": []string{"</a.css>", "</b.css>"}},
+			http.Header{"Link": {"</a.css>", "</b.css>"}},
+			0,
+			nil,
+		},
+		{
+			"line break",
+			"X-Q: {{ .q }}",
+			map[string]any{"q": "x\nLocation: //evil.example"},
+			nil,
+			0,
+			InvalidHeaderError,
+		},
+		{
+			"carriage return",
+			"X-Q: {{ .q }}",
+			map[string]any{"q": "x\r\nStatus: 302"},
+			nil,
+			0,
+			InvalidHeaderError,
+		},
+		{
+			"line break in called template",
+			`X-Q: {{ template "value" .q }}`,
+			map[string]any{"q": "x\nLocation: //evil.example"},
+			nil,
+			0,
+			InvalidHeaderError,
+		},
+		{
+			"line break in branch",
+			"{{ if .q }}X-Q: {{ .q }}{{ end }}",
+			map[string]any{"q": "x\nLocation: //evil.example"},
+			nil,
+			0,
+			InvalidHeaderError,
+		},
+		{
+			"long line",
+			"X-Q: {{ .q }}",
+			map[string]any{"q": strings.Repeat("x", 70000)},
+			nil,
+			0,
+			InvalidHeaderError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := template.Must(template.New("page").Parse(`{{ define "value" }}{{ . }}{{ end }}<p>{{ template "value" .q }}</p>`))
+			template.Must(page.New(TEMPLATE_HEADERS).Parse(tt.tmpl))
+
+			header, status, err := renderHeaders(page, tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			for k, v := range tt.want {
+				if strings.Join(header.Values(k), ",") != strings.Join(v, ",") {
+					t.Errorf("%s = %v, want %v", k, header.Values(k), v)
+				}
+			}
+			if len(header) != len(tt.want) {
+				t.Errorf("header = %v, want %v", header, tt.want)
+			}
+		})
+	}
+}
+
+// INFO: templates called from the headers template are escaped as copies, the body keeps line breaks
+func TestRenderHeadersKeepsBody(t *testing.T) {
+	page := template.Must(template.New("page").Parse(`{{ define "value" }}{{ . }}{{ end }}<p>{{ template "value" .q }}</p>`))
+	template.Must(page.New(TEMPLATE_HEADERS).Parse(`X-Q: {{ template "value" "ok" }}`))
+
+	_, _, err := renderHeaders(page, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	err = page.ExecuteTemplate(&b, "page", map[string]any{"q": "a\nb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.String() != "<p>a\nb</p>" {
+		t.Errorf("body = %q", b.String())
+	}
+}
@@ -30,3 +30,13 @@ func FSPathToPath(p string) string {
 
 	return p
 }
+
+// INFO: ParentPath returns the URL path of the directory above p, "/" being its own parent
+func ParentPath(p string) string {
+	segments := PathSegments(p)
+	if len(segments) == 0 {
+		return "/"
+	}
+
+	return FSPathToPath(strings.Join(segments[:len(segments)-1], "/"))
+}
@@ -0,0 +1,49 @@
+package templating
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// IsPartial reports whether a request was made by htmx to swap a part of the page.
+// Boosted requests swap the whole body, so they get the full page.
+func IsPartial(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true"
+}
+
+// INFO: renderPartial renders the template named like the id of the htmx target element, falling back to
+// the body template, without the layout around it. All templates starting with TEMPLATE_OOB_PREFIX are
+// appended, so routes can define out-of-band swaps by adding hx-swap-oob to their root elements.
+func renderPartial(w io.Writer, r *http.Request, t *template.Template, data any) error {
+	name := TEMPLATE_BODY
+	target := r.Header.Get("HX-Target")
+	if target != "" && t.Lookup(target) != nil {
+		name = target
+	}
+
+	err := t.ExecuteTemplate(w, name, data)
+	if err != nil {
+		return err
+	}
+
+	oob := []string{}
+	for _, st := range t.Templates() {
+		if strings.HasPrefix(st.Name(), TEMPLATE_OOB_PREFIX) {
+			oob = append(oob, st.Name())
+		}
+	}
+
+	slices.Sort(oob)
+
+	for _, name := range oob {
+		err := t.ExecuteTemplate(w, name, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,112 +3,378 @@ package templating
 import (
 	"html/template"
 	"io/fs"
+	"log"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pocketbase/pocketbase/tools/store"
 	"github.com/yalue/merged_fs"
 )
 
-// TODO: Implement Handler interface, maybe in template? But then template would need to know about the layout registry
-// Function signature: func (t *templateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
-// A static Handler could incoporate both the layout registry and the template registry and serve templates that dont need any data
+// INFO: Handler in handler.go combines the layout registry and the template registry into a http.Handler.
+// Like the TemplateRegistry, a LayoutRegistry is safe for concurrent use: Parse builds a new
+// layoutTree, which is swapped in atomically.
 type LayoutRegistry struct {
 	layoutsFS fs.FS
-	parsed    bool
+	// INFO: mu serializes parsing and guards funcs. Each layoutTree holds a copy of the funcs it was parsed with.
+	mu   sync.Mutex
+	tree atomic.Pointer[layoutTree]
+	// INFO: stale is set if funcs or the collision policy changed since the tree was parsed
+	stale atomic.Bool
+	funcs template.FuncMap
+	mode  ParseMode
+	// INFO: how templates sharing a name are treated, see SetCollisionPolicy
+	policy CollisionPolicy
+}
+
+// INFO: A layoutTree is never modified after parsing, except for its cache, which is safe for concurrent use
+type layoutTree struct {
 	// INFO: Layout & cache keys are template directory names
 	layouts map[string]TemplateContext
-	cache   *store.Store[*template.Template]
-	funcs   template.FuncMap
+	// INFO: Errors of broken layouts, keyed by layout name
+	broken map[string]error
+	cache  *store.Store[*template.Template]
+	funcs  template.FuncMap
+	// INFO: templates sharing a name, keyed by layout name
+	collisions *store.Store[[]Collision]
+	policy     CollisionPolicy
 }
 
 func NewLayoutRegistry(routes fs.FS) *LayoutRegistry {
-	return &LayoutRegistry{
+	registry := &LayoutRegistry{
 		layoutsFS: routes,
-		parsed:    false,
-		layouts:   make(map[string]TemplateContext),
-		cache:     store.New[*template.Template](nil),
 		funcs: template.FuncMap{
 			"safe": func(s string) template.HTML {
 				return template.HTML(s)
 			},
 		},
 	}
+
+	// INFO: templates using components must parse, the component funcs are bound on execution
+	maps.Copy(registry.funcs, componentFuncs(nil))
+
+	return registry
 }
 
-// NOTE: Upon registering a new layout dir, we return a new LayoutRegistry
-func (r *LayoutRegistry) Register(fs fs.FS) *LayoutRegistry {
-	return NewLayoutRegistry(merged_fs.MergeMultiple(fs, r.layoutsFS))
+// Register mounts a layouts FS under a layout name, e.g. "docs" makes the layout directory "blog"
+// of fs available as "docs/blog", see MountFS. An empty name or "/" merges fs with the existing layouts.
+// NOTE: Upon registering a new layout dir, we return a new LayoutRegistry, with the funcs and parse mode of r
+func (r *LayoutRegistry) Register(name string, fs fs.FS) *LayoutRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registry := NewLayoutRegistry(merged_fs.MergeMultiple(MountFS(name, fs), r.layoutsFS))
+	maps.Copy(registry.funcs, r.funcs)
+	registry.mode = r.mode
+	registry.policy = r.policy
+
+	return registry
 }
 
-// TODO: Funcs are not used in executing the templates yet
+// RegisterFuncs makes funcs available in all layout templates. Registering funcs after
+// parsing marks the current layout tree as stale, it is parsed again on next use.
 func (r *LayoutRegistry) RegisterFuncs(funcs template.FuncMap) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	for k, v := range funcs {
 		r.funcs[k] = v
 	}
+
+	r.stale.Store(true)
 }
 
+// INFO: Every directory in the layouts FS is a layout, named by its FS path, e.g. "default".
+// Subdirectories are layouts nested inside the layout of their parent directory, e.g. "default/admin",
+// unless a layout file names a different parent layout.
+// Parse compiles all layouts and replaces the current layout tree, requests in flight keep using
+// the tree they started with. Errors are reported and handled like in TemplateRegistry.Parse.
 func (r *LayoutRegistry) Parse() error {
-	// INFO: setting parsed first is important, as it avoids infinit loops in Get() below
-	r.parsed = true
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.swap(r.parse(nil, nil))
+}
+
+// INFO: swap stores a parsed tree according to the parse mode. It must be called with mu held.
+func (r *LayoutRegistry) swap(tree *layoutTree, err error) error {
+	if err != nil && r.mode == Strict {
+		return err
+	}
+
+	r.tree.Store(tree)
+	r.stale.Store(false)
+	return err
+}
+
+// SetMode sets how Parse, Reload and lazy parsing treat broken layouts, the default is Lenient
+func (r *LayoutRegistry) SetMode(mode ParseMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mode = mode
+}
+
+// SetCollisionPolicy sets how Parse and Reload treat templates sharing a name, the default is AllowCollisions.
+// Setting the policy after parsing marks the current layout tree as stale, it is parsed again on next use.
+func (r *LayoutRegistry) SetCollisionPolicy(policy CollisionPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.policy = policy
+	r.stale.Store(true)
+}
+
+// Collisions lists the templates of a layout sharing a name with another template, not including
+// the layouts it is nested in. Sources shows the resulting shadowing chains.
+func (r *LayoutRegistry) Collisions(name string) []Collision {
+	tree, err := r.current()
+	if err != nil {
+		return nil
+	}
+
+	return slices.Clone(tree.collisions.Get(name))
+}
+
+// Broken returns the errors of all broken layouts of the current layout tree, keyed by layout name
+func (r *LayoutRegistry) Broken() map[string]error {
+	tree := r.tree.Load()
+	if tree == nil {
+		return map[string]error{}
+	}
+
+	return maps.Clone(tree.broken)
+}
+
+// INFO: current returns the parsed layout tree, parsing it on first use and after it became stale.
+// In Strict mode, a stale tree is kept if parsing it again fails, like on Parse.
+func (r *LayoutRegistry) current() (*layoutTree, error) {
+	tree := r.tree.Load()
+	if tree != nil && !r.stale.Load() {
+		return tree, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// INFO: another goroutine might have parsed while we were waiting for the lock
+	tree = r.tree.Load()
+	if tree != nil && !r.stale.Load() {
+		return tree, nil
+	}
+
+	err := r.swap(r.parse(nil, nil))
+	if err != nil && r.mode == Strict {
+		if tree == nil {
+			return nil, err
+		}
+
+		// INFO: we do not parse again on every request, the next Parse or Reload tries again
+		log.Printf("templating: keeping the previous layout tree: %v", err)
+		r.stale.Store(false)
+	}
+
+	return r.tree.Load(), nil
+}
+
+// INFO: parse always returns a tree, with broken layouts recorded in tree.broken. Compiled layouts of
+// old are reused for all layouts not affected by inv, see Reload. old may be nil to compile everything.
+func (r *LayoutRegistry) parse(old *layoutTree, inv invalidation) (*layoutTree, error) {
+	tree := &layoutTree{
+		layouts:    make(map[string]TemplateContext),
+		broken:     make(map[string]error),
+		cache:      store.New[*template.Template](nil),
+		funcs:      maps.Clone(r.funcs),
+		collisions: store.New[[]Collision](nil),
+		policy:     r.policy,
+	}
+
+	errs := ParseErrors{}
 
 	rootcontext := NewTemplateContext(".")
 	err := rootcontext.Parse(r.layoutsFS)
 	if err != nil {
-		return err
+		return tree, append(errs, err)
 	}
 
-	globals := rootcontext.GetGlobals()
+	err = fs.WalkDir(r.layoutsFS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, NewError(FileAccessError, path))
+			if d != nil && d.IsDir() && path != "." {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if !d.IsDir() || path == "." {
+			return nil
+		}
+
+		if d.Name() == TEMPLATE_COMPONENT_DIRECTORY {
+			return fs.SkipDir
+		}
+
+		url := FSPathToPath(path)
+		context := NewTemplateContext(url)
 
-	entries, err := fs.ReadDir(r.layoutsFS, ".")
+		parentname := filepath.Dir(path)
+		parent, ok := tree.layouts[parentname]
+		if ok {
+			context.Inherit(parent)
+			context.Layout = parentname
+		} else {
+			context.Inherit(rootcontext)
+		}
+
+		err = context.Parse(r.layoutsFS)
+		if err != nil {
+			tree.broken[path] = err
+			errs = append(errs, err)
+		}
+
+		tree.layouts[path] = context
+
+		return nil
+	})
 	if err != nil {
-		return NewError(FileAccessError, ".")
+		errs = append(errs, err)
+	}
+
+	names := slices.Sorted(maps.Keys(tree.layouts))
+
+	if old != nil {
+		for _, name := range names {
+			if _, ok := tree.broken[name]; ok || tree.affected(name, inv) {
+				continue
+			}
+
+			if t := old.cache.Get(name); t != nil {
+				tree.cache.Set(name, t)
+				tree.collisions.Set(name, old.collisions.Get(name))
+			}
+		}
 	}
 
-	for _, e := range entries {
-		if !e.IsDir() || e.Name() == TEMPLATE_COMPONENT_DIRECTORY {
+	for _, name := range names {
+		if _, ok := tree.broken[name]; ok {
 			continue
 		}
 
-		url := FSPathToPath(e.Name())
-		context := NewTemplateContext(url)
-		context.SetGlobals(globals)
-		context.Parse(r.layoutsFS)
+		_, err := r.get(tree, name, nil)
+		if err != nil {
+			tree.broken[name] = err
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return tree, errs
+	}
 
-		r.layouts[e.Name()] = context
+	return tree, nil
+}
+
+// Names returns the names of all layouts of the current layout tree, sorted
+func (r *LayoutRegistry) Names() []string {
+	tree, err := r.current()
+	if err != nil {
+		return nil
+	}
+
+	return slices.Sorted(maps.Keys(tree.layouts))
+}
+
+// Sources lists the templates of a layout and the files they are read from, nested layouts first
+func (r *LayoutRegistry) Sources(name string) []Source {
+	tree, err := r.current()
+	if err != nil {
+		return nil
+	}
+
+	sources := []Source{}
+	seen := []string{}
+	for name != "" && !slices.Contains(seen, name) {
+		context := tree.layouts[name]
+		sources = append(sources, context.Sources()...)
+		seen = append(seen, name)
+		name = context.Layout
 	}
 
-	return nil
+	return sources
 }
 
-// TODO: this pattern here might not be thread save, since parsed can be false for concurrent handlers when calling Get()
-// Maybe use the std/library once package to ensure Parse() is only called once
 func (r *LayoutRegistry) Get(name string) (*template.Template, error) {
-	cached := r.cache.Get(name)
+	tree, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.get(tree, name, nil)
+}
+
+// INFO: seen holds the names of the layouts nesting the requested layout, to detect cycles
+func (r *LayoutRegistry) get(tree *layoutTree, name string, seen []string) (*template.Template, error) {
+	cached := tree.cache.Get(name)
 	// This makes sense bc it is very likely cached on most requests
 	if cached != nil {
 		return cached, nil
 	}
 
-	context, ok := r.layouts[name]
+	context, ok := tree.layouts[name]
 	if !ok {
-		// This makes only sense to check ONCE, we will have to call NewError(NoTemplateError, name) 99.9999999999% of the requests
-		if !r.parsed {
-			err := r.Parse()
-			if err != nil {
-				return nil, err
-			}
+		return nil, NewError(NoTemplateError, name)
+	}
 
-			return r.Get(name)
-		}
+	if err, ok := tree.broken[name]; ok {
+		return nil, err
+	}
 
-		return nil, NewError(NoTemplateError, name)
+	if slices.Contains(seen, name) {
+		return nil, NewError(InvalidLayoutError, strings.Join(append(seen, name), " -> "))
 	}
 
-	t, err := context.Get(r.layoutsFS)
+	t, collisions, err := context.get(r.layoutsFS, tree.funcs)
 	if err != nil {
 		return nil, err
 	}
 
-	r.cache.Set(name, t)
+	collisions = append(context.Collisions(), collisions...)
+	tree.collisions.Set(name, collisions)
+
+	err = collide(tree.policy, name, collisions)
+	if err != nil {
+		return nil, err
+	}
+
+	// INFO: a nested layout is its parent layout with the templates of the nested layout added,
+	// so a nested layout overwrites blocks of its parent, e.g. "body", and may define new blocks
+	if context.Layout != "" {
+		parent, err := r.get(tree, context.Layout, append(seen, name))
+		if err != nil {
+			return nil, err
+		}
+
+		parent, err = parent.Clone()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, st := range t.Templates() {
+			_, err := parent.AddParseTree(st.Name(), st.Tree)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		t = parent
+	}
+
+	// INFO: cached layouts are shared between requests, they must be cloned before adding templates or executing them
+	tree.cache.Set(name, t)
 
-	return context.Get(r.layoutsFS)
+	return t, nil
 }
@@ -0,0 +1,46 @@
+package templating
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestLayoutRegistryConcurrentReload(t *testing.T) {
+	h := stressHandler(t)
+	changed := [][]string{
+		{"default/root.tmpl"},
+		{"default/admin/body.tmpl"},
+		{"default/admin"},
+	}
+
+	stress(t, h, map[string]string{
+		"/":       "<html><body>root hello",
+		"/admin/": "<html><body><main>admin hello</main></body></html>",
+	}, func(i int) {
+		if err := h.Layouts.Reload(changed[i%len(changed)]); err != nil {
+			t.Error(err)
+		}
+	}, func(i int) {
+		if err := h.Layouts.Parse(); err != nil {
+			t.Error(err)
+		}
+	}, func(i int) {
+		h.Layouts.RegisterFuncs(template.FuncMap{"greet": func() string { return "hello" }})
+	})
+}
+
+func TestLayoutRegistryConcurrentGet(t *testing.T) {
+	h := stressHandler(t)
+
+	stress(t, h, map[string]string{
+		"/admin/": "<main>admin hello</main>",
+	}, func(i int) {
+		if _, err := h.Layouts.Get("default/admin"); err != nil {
+			t.Error(err)
+		}
+	}, func(i int) {
+		if err := h.Routes.Reload([]string{"admin/content.tmpl"}); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,486 @@
+package templating
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/store"
+)
+
+// INFO: live component instances without connected clients are discarded after this time
+const LIVE_TTL = 30 * time.Minute
+
+// INFO: the number of live component instances kept, and of preloads. When full, the least recently used one is discarded.
+const LIVE_MAX_INSTANCES = 10000
+
+// INFO: how often Sweep discards expired instances and preloads
+const LIVE_SWEEP_INTERVAL = time.Minute
+
+// INFO: name of the form value carrying the event of a live component, see the on func
+const LIVE_EVENT_KEY = "event"
+
+// INFO: name of the form value carrying the token of a live component instance
+const LIVE_TOKEN_KEY = "token"
+
+// INFO: funcs rendering components that need the Live of the server, pages using them are not exported
+var LIVE_FUNCS = []string{"live", "preload"}
+
+// A Controller drives a live component: a component template re-rendered on the server for every
+// event of the client, e.g. a click. The state of each component instance is kept on the server.
+type Controller interface {
+	// Mount returns the initial state of a component instance from the data the live func was called with
+	Mount(r *http.Request, data any) (any, error)
+	// HandleEvent returns the new state of a component instance after a client event.
+	// values holds the form values sent with the event, e.g. the fields of a form.
+	HandleEvent(event string, values url.Values, state any) (any, error)
+}
+
+// Live serves live components. Pages render a component with {{ live "counter" . }}, which
+// mounts an instance of the controller registered as "counter" and renders the component
+// template of the same name with its state. Elements of the component send events with
+// {{ on "increment" }}, e.g. <button {{ on "increment" }}>+</button>.
+// Events are posted to Path, the re-rendered component is streamed back to the page via server
+// sent events from Path. Mount Live at Path for GET and POST, set it on the Handler and run Sweep.
+type Live struct {
+	Path        string
+	key         []byte
+	controllers *store.Store[Controller]
+	instances   *lru[*instance]
+	preloaders  *store.Store[PreLoadController]
+	preloads    *lru[*preload]
+}
+
+// INFO: an instance is a live component on a page, rendered with the template set of that page
+type instance struct {
+	id         string
+	controller string
+	t          *template.Template
+	// INFO: mu guards state and clients. Events of an instance are handled one after the other.
+	mu      sync.Mutex
+	state   any
+	clients map[chan template.HTML]struct{}
+}
+
+// INFO: a binding binds the live funcs to the render of a page. The template set of the page is kept by
+// its instances, so the request is dropped after the render. Instances of failed renders are discarded.
+type binding struct {
+	live *Live
+	t    *template.Template
+	// INFO: mu guards r and the ids, funcs may be called concurrently, e.g. by Render and ServeHTTP
+	mu        sync.Mutex
+	r         *http.Request
+	instances []string
+	preloads  []string
+}
+
+// NewLive creates a Live with a random key for signing tokens, so tokens are only valid
+// until the server restarts, which is also when all component state is lost
+func NewLive(path string) *Live {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	return &Live{
+		Path:        path,
+		key:         key,
+		controllers: store.New[Controller](nil),
+		instances:   newLRU[*instance](LIVE_MAX_INSTANCES),
+		preloaders:  store.New[PreLoadController](nil),
+		preloads:    newLRU[*preload](LIVE_MAX_INSTANCES),
+	}
+}
+
+// Sweep discards instances nobody is connected to anymore and preloads nobody fetched, every
+// LIVE_SWEEP_INTERVAL until ctx is done. Without it, they are only discarded when the Live is full.
+func (l *Live) Sweep(ctx context.Context) {
+	ticker := time.NewTicker(LIVE_SWEEP_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.sweep(now)
+		}
+	}
+}
+
+// INFO: sweep discards the instances and preloads not used since LIVE_TTL before now
+func (l *Live) sweep(now time.Time) {
+	l.instances.Expire(now.Add(-LIVE_TTL), func(inst *instance) bool {
+		inst.mu.Lock()
+		defer inst.mu.Unlock()
+		return len(inst.clients) > 0
+	})
+
+	l.preloads.Expire(now.Add(-LIVE_TTL), nil)
+}
+
+// Register makes a controller available to the live func under a name
+func (l *Live) Register(name string, controller Controller) {
+	l.controllers.Set(name, controller)
+}
+
+// Funcs returns the live funcs for parsing. The Handler binds them to every page it renders.
+func (l *Live) Funcs() template.FuncMap {
+	return (&binding{live: l}).funcs()
+}
+
+// UsesLive reports whether the page of a routing path renders live components or preloads, see
+// LIVE_FUNCS. Such pages only work with the Live of a running server, e.g. they can not be exported.
+func (h *Handler) UsesLive(route string) (bool, error) {
+	tree, err := h.Routes.current()
+	if err != nil {
+		return false, err
+	}
+
+	t, err := h.page(tree, route)
+	if err != nil {
+		return false, err
+	}
+
+	return usesFuncs(t, LIVE_FUNCS), nil
+}
+
+// INFO: bind binds the live funcs to a request and the template set of its page, like componentFuncs.
+// Call done with the error of the render once it returns.
+func (l *Live) bind(r *http.Request, t *template.Template) *binding {
+	return &binding{live: l, r: r, t: t}
+}
+
+// INFO: request returns the request of the render, nil once it is done
+func (b *binding) request() *http.Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.r
+}
+
+// INFO: done ends the render, discarding the instances and preloads it created if it failed
+func (b *binding) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.r = nil
+	if err != nil {
+		for _, id := range b.instances {
+			b.live.instances.Remove(id)
+		}
+
+		for _, id := range b.preloads {
+			if p, ok := b.live.preloads.Get(id); ok {
+				p.cancel()
+				b.live.preloads.Remove(id)
+			}
+		}
+	}
+	b.instances = nil
+	b.preloads = nil
+}
+
+func (b *binding) funcs() template.FuncMap {
+	l := b.live
+
+	return template.FuncMap{
+		"live": func(name string, data ...any) (template.HTML, error) {
+			r := b.request()
+			if b.t == nil || r == nil {
+				return "", NewError(NoLiveContextError, name)
+			}
+
+			var dot any
+			if len(data) > 0 {
+				dot = data[0]
+			}
+
+			return l.mount(b, r, name, dot)
+		},
+		"preload": func(name string, data ...any) (template.HTML, error) {
+			r := b.request()
+			if b.t == nil || r == nil {
+				return "", NewError(NoLiveContextError, name)
+			}
+
+			var dot any
+			if len(data) > 0 {
+				dot = data[0]
+			}
+
+			return l.preload(b, r, name, dot)
+		},
+		"on": func(event string) template.HTMLAttr {
+			vals, _ := json.Marshal(map[string]string{LIVE_EVENT_KEY: event})
+			return template.HTMLAttr(`hx-post="` + template.HTMLEscapeString(l.Path) + `" hx-vals="` + template.HTMLEscapeString(string(vals)) + `"`)
+		},
+	}
+}
+
+func (l *Live) mount(b *binding, r *http.Request, name string, data any) (template.HTML, error) {
+	controller := l.controllers.Get(name)
+	if controller == nil {
+		return "", NewError(NoControllerError, name)
+	}
+
+	state, err := controller.Mount(r, data)
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	inst := &instance{
+		id:         hex.EncodeToString(id),
+		controller: name,
+		t:          b.t,
+		state:      state,
+		clients:    make(map[chan template.HTML]struct{}),
+	}
+
+	html, err := executeComponent(b.t, name, state)
+	if err != nil {
+		return "", err
+	}
+
+	l.instances.Set(inst.id, inst)
+
+	b.mu.Lock()
+	b.instances = append(b.instances, inst.id)
+	b.mu.Unlock()
+
+	token := l.sign(inst.id)
+	vals, _ := json.Marshal(map[string]string{LIVE_TOKEN_KEY: token})
+
+	// INFO: the hx-vals with the token and hx-swap are inherited by all elements of the component
+	return template.HTML(`<div id="live-` + inst.id + `" data-live="` + template.HTMLEscapeString(token) +
+		`" hx-vals="` + template.HTMLEscapeString(string(vals)) + `" hx-swap="none">` + string(html) + `</div>`), nil
+}
+
+// INFO: tokens are the instance or preload id signed with the key, so clients can not guess other instances
+func (l *Live) sign(id string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// INFO: unsign returns the id of a token signed by this Live
+func (l *Live) unsign(token string) (string, error) {
+	id, _, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(l.sign(id)), []byte(token)) {
+		return "", NewHTTPError(http.StatusForbidden, InvalidTokenError)
+	}
+
+	return id, nil
+}
+
+func (l *Live) verify(token string) (*instance, error) {
+	id, err := l.unsign(token)
+	if err != nil {
+		return nil, err
+	}
+
+	inst, ok := l.instances.Get(id)
+	if !ok {
+		return nil, NewHTTPError(http.StatusGone, NewError(NoInstanceError, id))
+	}
+
+	return inst, nil
+}
+
+// Update changes the state of every instance of a controller and streams the re-rendered
+// components to the connected clients, e.g. for changes not caused by the client
+func (l *Live) Update(controller string, update func(state any) (any, error)) error {
+	for _, inst := range l.instances.Values() {
+		if inst.controller != controller {
+			continue
+		}
+
+		_, err := inst.update(update)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// INFO: update renders the new state and sends it to all connected clients
+func (i *instance) update(update func(state any) (any, error)) (template.HTML, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	state, err := update(i.state)
+	if err != nil {
+		return "", err
+	}
+
+	html, err := executeComponent(i.t, i.controller, state)
+	if err != nil {
+		return "", err
+	}
+
+	i.state = state
+
+	for c := range i.clients {
+		select {
+		case c <- html:
+		default:
+			// INFO: the client is slow, it gets the latest render only
+			select {
+			case <-c:
+			default:
+			}
+			c <- html
+		}
+	}
+
+	return html, nil
+}
+
+func (l *Live) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Has(LIVE_PRELOAD_KEY) {
+			l.deliver(w, r)
+			return
+		}
+		l.stream(w, r)
+	case http.MethodPost:
+		l.event(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// INFO: fail responds with the status code of err, server errors are logged like by Handler.fail
+func (l *Live) fail(w http.ResponseWriter, r *http.Request, err error) {
+	code := StatusCode(err)
+	logError(r, code, err)
+	http.Error(w, http.StatusText(code), code)
+}
+
+// INFO: event routes a client event to the controller of the instance
+func (l *Live) event(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		l.fail(w, r, NewHTTPError(http.StatusBadRequest, err))
+		return
+	}
+
+	inst, err := l.verify(r.PostForm.Get(LIVE_TOKEN_KEY))
+	if err != nil {
+		l.fail(w, r, err)
+		return
+	}
+
+	controller := l.controllers.Get(inst.controller)
+	if controller == nil {
+		l.fail(w, r, NewHTTPError(http.StatusNotFound, NewError(NoControllerError, inst.controller)))
+		return
+	}
+
+	html, err := inst.update(func(state any) (any, error) {
+		return controller.HandleEvent(r.PostForm.Get(LIVE_EVENT_KEY), r.PostForm, state)
+	})
+	if err != nil {
+		l.fail(w, r, err)
+		return
+	}
+
+	inst.mu.Lock()
+	connected := len(inst.clients) > 0
+	inst.mu.Unlock()
+
+	if connected {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// INFO: without a stream, e.g. while it reconnects, the component is swapped by htmx from the response
+	w.Header().Set("HX-Retarget", "#live-"+inst.id)
+	w.Header().Set("HX-Reswap", "innerHTML")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
+
+// INFO: stream sends every render of the instance as a render event
+func (l *Live) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	inst, err := l.verify(r.URL.Query().Get(LIVE_TOKEN_KEY))
+	if err != nil {
+		l.fail(w, r, err)
+		return
+	}
+
+	c := make(chan template.HTML, 1)
+
+	inst.mu.Lock()
+	inst.clients[c] = struct{}{}
+	inst.mu.Unlock()
+
+	defer func() {
+		inst.mu.Lock()
+		delete(inst.clients, c)
+		inst.mu.Unlock()
+
+		// INFO: the instance expires LIVE_TTL after its last client left
+		l.instances.Touch(inst.id)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case html := <-c:
+			var b bytes.Buffer
+			b.WriteString("event: render\n")
+			for _, line := range strings.Split(string(html), "\n") {
+				fmt.Fprintf(&b, "data: %s\n", line)
+			}
+			b.WriteString("\n")
+			w.Write(b.Bytes())
+			flusher.Flush()
+		}
+	}
+}
+
+// Script returns the client script connecting live components to their stream, also after htmx swaps
+func (l *Live) Script() string {
+	return `<script>(() => {
+	const connect = (root) => [root, ...root.querySelectorAll("[data-live]")].forEach((el) => {
+		if (!el.dataset || !el.dataset.live || el.liveSource) return;
+		el.liveSource = new EventSource("` + template.JSEscapeString(l.Path) + `?token=" + encodeURIComponent(el.dataset.live));
+		el.liveSource.addEventListener("render", (e) => {
+			if (!el.isConnected) return el.liveSource.close();
+			el.innerHTML = e.data;
+			if (window.htmx) htmx.process(el);
+		});
+	});
+	document.addEventListener("DOMContentLoaded", () => connect(document.body));
+	document.addEventListener("htmx:load", (e) => connect(e.detail.elt));
+})();</script>`
+}
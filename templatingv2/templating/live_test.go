@@ -0,0 +1,260 @@
+package templating
+
+import (
+	"bufio"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var liveToken = regexp.MustCompile(`data-live="([^"]+)"`)
+
+// INFO: testCounter counts the inc events of an instance, mounting fails with the data "fail"
+type testCounter struct{}
+
+func (testCounter) Mount(r *http.Request, data any) (any, error) {
+	if data == "fail" {
+		return nil, errors.New("mount failed")
+	}
+
+	return 0, nil
+}
+
+func (testCounter) HandleEvent(event string, values url.Values, state any) (any, error) {
+	if event != "inc" {
+		return nil, errors.New("unknown event " + event)
+	}
+
+	return state.(int) + 1, nil
+}
+
+func liveHandler(t *testing.T) (*Handler, *Live) {
+	t.Helper()
+
+	l := NewLive("/_live")
+	l.Register("counter", testCounter{})
+
+	lr := NewLayoutRegistry(fstest.MapFS{
+		"default/root.tmpl": {Data: []byte(`<html><body>{{ block "body" . }}{{ end }}</body></html>`)},
+	})
+	tr := NewTemplateRegistry(fstest.MapFS{
+		"body.tmpl":                      {Data: []byte(`{{ live "counter" . }}`)},
+		"components/counter.tmpl":        {Data: []byte(`<button {{ on "inc" }}>{{ . }}</button>`)},
+		"broken/body.tmpl":               {Data: []byte(`{{ live "counter" . }}{{ live "counter" "fail" }}`)},
+		"broken/components/counter.tmpl": {Data: []byte(`{{ . }}`)},
+	})
+	lr.RegisterFuncs(l.Funcs())
+	tr.RegisterFuncs(l.Funcs())
+
+	if err := lr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(lr, tr)
+	h.Live = l
+	return h, l
+}
+
+// INFO: mount renders the root page and returns the token of its counter
+func mount(t *testing.T, h *Handler) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	m := liveToken.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatalf("GET /: no live component: %s", rec.Body.String())
+	}
+
+	return m[1]
+}
+
+func postEvent(l *Live, token, event string) *httptest.ResponseRecorder {
+	form := url.Values{LIVE_TOKEN_KEY: {token}, LIVE_EVENT_KEY: {event}}
+	req := httptest.NewRequest(http.MethodPost, l.Path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLiveTokens(t *testing.T) {
+	h, l := liveHandler(t)
+	token := mount(t, h)
+	id, sig, _ := strings.Cut(token, ".")
+
+	other := []byte(id)
+	other[0] ^= 1
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"valid", token, http.StatusOK},
+		{"empty", "", http.StatusForbidden},
+		{"unsigned", id, http.StatusForbidden},
+		{"other id", string(other) + "." + sig, http.StatusForbidden},
+		{"other signature", id + "." + strings.Repeat("A", len(sig)), http.StatusForbidden},
+		{"other key", NewLive(l.Path).sign(id), http.StatusForbidden},
+		{"unknown id", l.sign(string(other)), http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		rec := postEvent(l, tt.token, "inc")
+		if rec.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestLiveEventWithoutStream(t *testing.T) {
+	h, l := liveHandler(t)
+	token := mount(t, h)
+	id, _, _ := strings.Cut(token, ".")
+
+	for want := 1; want <= 2; want++ {
+		rec := postEvent(l, token, "inc")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+
+		if got := rec.Header().Get("HX-Retarget"); got != "#live-"+id {
+			t.Errorf("HX-Retarget = %q, want #live-%s", got, id)
+		}
+		if got := rec.Header().Get("HX-Reswap"); got != "innerHTML" {
+			t.Errorf("HX-Reswap = %q, want innerHTML", got)
+		}
+		if !strings.HasSuffix(rec.Body.String(), ">"+string(rune('0'+want))+"</button>") {
+			t.Errorf("event %d rendered %q", want, rec.Body.String())
+		}
+	}
+
+	rec := postEvent(l, token, "unknown")
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "unknown event") {
+		t.Errorf("failed event: status %d: %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLiveEventStream(t *testing.T) {
+	h, l := liveHandler(t)
+	token := mount(t, h)
+
+	srv := httptest.NewServer(l)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?" + url.Values{LIVE_TOKEN_KEY: {token}}.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream: status %d, content type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	// INFO: instances with a connected client are kept, however old
+	l.sweep(time.Now().Add(2 * LIVE_TTL))
+
+	// INFO: the client is connected once the stream responds, so the render is streamed
+	rec := postEvent(l, token, "inc")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("event: status %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	var lines []string
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+
+	if len(lines) != 2 || lines[0] != "event: render" || !strings.HasSuffix(lines[1], ">1</button>") {
+		t.Errorf("stream sent %q", lines)
+	}
+}
+
+func TestLiveExpiry(t *testing.T) {
+	h, l := liveHandler(t)
+	token := mount(t, h)
+
+	l.sweep(time.Now())
+	if rec := postEvent(l, token, "inc"); rec.Code != http.StatusOK {
+		t.Fatalf("fresh instance: status %d", rec.Code)
+	}
+
+	l.sweep(time.Now().Add(LIVE_TTL + time.Second))
+	if rec := postEvent(l, token, "inc"); rec.Code != http.StatusGone {
+		t.Errorf("expired instance: status %d, want %d", rec.Code, http.StatusGone)
+	}
+}
+
+func TestLiveLimit(t *testing.T) {
+	h, l := liveHandler(t)
+	l.instances.max = 2
+
+	first := mount(t, h)
+	mount(t, h)
+	// INFO: using the first instance makes the second one the least recently used
+	postEvent(l, first, "inc")
+	mount(t, h)
+
+	if n := l.instances.Len(); n != 2 {
+		t.Errorf("%d instances, want 2", n)
+	}
+	if rec := postEvent(l, first, "inc"); rec.Code != http.StatusOK {
+		t.Errorf("recently used instance: status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestLiveFailedRender(t *testing.T) {
+	h, l := liveHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/broken/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET /broken/: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if n := l.instances.Len(); n != 0 {
+		t.Errorf("failed render kept %d instances", n)
+	}
+}
+
+func TestLiveBindingReleasesRequest(t *testing.T) {
+	h, l := liveHandler(t)
+
+	tree, err := h.Routes.current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := h.page(tree, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := l.bind(httptest.NewRequest(http.MethodGet, "/", nil), page)
+	b.done(nil)
+
+	live := b.funcs()["live"].(func(string, ...any) (template.HTML, error))
+	if _, err := live("counter"); !errors.Is(err, NoLiveContextError) {
+		t.Errorf("live after the render: %v, want %v", err, NoLiveContextError)
+	}
+	if b.request() != nil {
+		t.Error("binding keeps the request after the render")
+	}
+}
@@ -0,0 +1,134 @@
+package templating
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// INFO: an lru keeps at most max values by key, discarding the least recently used value when full.
+// Unlike store.Store it is ordered by use, so expired values are found without walking all of them.
+// It is safe for concurrent use.
+type lru[T any] struct {
+	mu  sync.Mutex
+	max int
+	// INFO: the most recently used value is at the front
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[T any] struct {
+	key   string
+	value T
+	used  time.Time
+}
+
+func newLRU[T any](max int) *lru[T] {
+	return &lru[T]{
+		max:   max,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// INFO: Get returns the value of a key and marks it as used
+func (c *lru[T]) Get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	c.touch(e)
+	return e.Value.(*lruEntry[T]).value, true
+}
+
+// INFO: Touch marks a key as used, e.g. when a client disconnects
+func (c *lru[T]) Touch(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.touch(e)
+	}
+}
+
+func (c *lru[T]) touch(e *list.Element) {
+	e.Value.(*lruEntry[T]).used = time.Now()
+	c.order.MoveToFront(e)
+}
+
+// INFO: Set adds or replaces the value of a key, discarding the least recently used value if c is full
+func (c *lru[T]) Set(key string, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry[T]).value = value
+		c.touch(e)
+		return
+	}
+
+	for c.max > 0 && c.order.Len() >= c.max {
+		c.remove(c.order.Back())
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[T]{key: key, value: value, used: time.Now()})
+}
+
+func (c *lru[T]) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *lru[T]) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.items, e.Value.(*lruEntry[T]).key)
+}
+
+// INFO: Values returns all values, most recently used first
+func (c *lru[T]) Values() []T {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([]T, 0, c.order.Len())
+	for e := c.order.Front(); e != nil; e = e.Next() {
+		values = append(values, e.Value.(*lruEntry[T]).value)
+	}
+
+	return values
+}
+
+func (c *lru[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// INFO: Expire removes all values last used before a time, unless keep returns true for them.
+// Only the expired values and the kept ones are visited, starting with the least recently used.
+func (c *lru[T]) Expire(before time.Time, keep func(value T) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.order.Back(); e != nil; {
+		prev := e.Prev()
+		entry := e.Value.(*lruEntry[T])
+		if !entry.used.Before(before) {
+			return
+		}
+
+		if keep == nil || !keep(entry.value) {
+			c.remove(e)
+		}
+		e = prev
+	}
+}
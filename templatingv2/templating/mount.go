@@ -0,0 +1,132 @@
+package templating
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// MountFS returns a FS containing fsys under the directory of a URL path, e.g. "/docs/"
+// puts the root of fsys at "docs". The directories above the mount point exist, but are
+// empty apart from the mount point. For the root path, fsys is returned as is.
+func MountFS(prefix string, fsys fs.FS) fs.FS {
+	prefix = PathToFSPath(FSPathToPath(prefix))
+	if prefix == "." {
+		return fsys
+	}
+
+	return &mountFS{prefix: prefix, fsys: fsys}
+}
+
+type mountFS struct {
+	// INFO: FS path of the mount point, e.g. "docs/api"
+	prefix string
+	fsys   fs.FS
+}
+
+func (m *mountFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == m.prefix {
+		f, err := m.fsys.Open(".")
+		if err != nil {
+			return nil, err
+		}
+
+		// INFO: the root directory of a FS is named ".", but here it is the mount point
+		return &mountRoot{File: f, name: path.Base(m.prefix)}, nil
+	}
+
+	if rel, ok := strings.CutPrefix(name, m.prefix+"/"); ok {
+		return m.fsys.Open(rel)
+	}
+
+	// INFO: directories above the mount point only contain the next directory towards it
+	if name == "." || strings.HasPrefix(m.prefix, name+"/") {
+		rest := strings.TrimPrefix(m.prefix, name+"/")
+		if name == "." {
+			rest = m.prefix
+		}
+		child, _, _ := strings.Cut(rest, "/")
+
+		return &mountDir{name: path.Base(name), child: child}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+type mountRoot struct {
+	fs.File
+	name string
+}
+
+func (r *mountRoot) Stat() (fs.FileInfo, error) {
+	info, err := r.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return mountInfo{FileInfo: info, name: r.name}, nil
+}
+
+func (r *mountRoot) ReadDir(n int) ([]fs.DirEntry, error) {
+	dir, ok := r.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: r.name, Err: fs.ErrInvalid}
+	}
+
+	return dir.ReadDir(n)
+}
+
+type mountInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i mountInfo) Name() string {
+	return i.name
+}
+
+// INFO: mountDir is a directory above the mount point, it is a directory as well as its only entry
+type mountDir struct {
+	name  string
+	child string
+	read  bool
+}
+
+func (d *mountDir) Stat() (fs.FileInfo, error) {
+	return dirInfo(d.name), nil
+}
+
+func (d *mountDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *mountDir) Close() error {
+	return nil
+}
+
+func (d *mountDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.read {
+		if n > 0 {
+			return nil, io.EOF
+		}
+		return []fs.DirEntry{}, nil
+	}
+
+	d.read = true
+	return []fs.DirEntry{fs.FileInfoToDirEntry(dirInfo(d.child))}, nil
+}
+
+type dirInfo string
+
+func (i dirInfo) Name() string       { return string(i) }
+func (i dirInfo) Size() int64        { return 0 }
+func (i dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (i dirInfo) ModTime() time.Time { return time.Time{} }
+func (i dirInfo) IsDir() bool        { return true }
+func (i dirInfo) Sys() any           { return nil }
@@ -0,0 +1,111 @@
+package templating
+
+import (
+	"slices"
+	"strings"
+)
+
+// INFO: Params holds the values captured by dynamic route segments.
+// The keys are the segment names without brackets, so a directory named [id]
+// matched against /posts/42/ yields Params{"id": "42"}
+type Params map[string]string
+
+func (p Params) Get(name string) string {
+	return p[name]
+}
+
+const (
+	segmentStatic = iota
+	segmentDynamic
+	segmentCatchAll
+)
+
+// INFO: [name] matches exactly one path segment, [...name] matches one or more
+func segmentKind(s string) int {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return segmentStatic
+	}
+
+	if strings.HasPrefix(s, "[...") {
+		return segmentCatchAll
+	}
+
+	return segmentDynamic
+}
+
+func segmentName(s string) string {
+	s = strings.TrimPrefix(s, "[")
+	s = strings.TrimSuffix(s, "]")
+	return strings.TrimPrefix(s, "...")
+}
+
+func IsDynamicPath(p string) bool {
+	for _, s := range PathSegments(p) {
+		if segmentKind(s) != segmentStatic {
+			return true
+		}
+	}
+	return false
+}
+
+func PathSegments(p string) []string {
+	p = PathToFSPath(p)
+	if p == "." || p == "" {
+		return []string{}
+	}
+	return strings.Split(p, "/")
+}
+
+// INFO: matchPath matches a URL path against a route pattern like /posts/[id]/
+func matchPath(pattern, p string) (Params, bool) {
+	ps := PathSegments(pattern)
+	ss := PathSegments(p)
+	params := Params{}
+
+	for i, s := range ps {
+		switch segmentKind(s) {
+		case segmentCatchAll:
+			// INFO: catch-all segments must be the last segment of a pattern
+			if i != len(ps)-1 || i >= len(ss) {
+				return nil, false
+			}
+			params[segmentName(s)] = strings.Join(ss[i:], "/")
+			return params, true
+		case segmentDynamic:
+			if i >= len(ss) || ss[i] == "" {
+				return nil, false
+			}
+			params[segmentName(s)] = ss[i]
+		default:
+			if i >= len(ss) || ss[i] != s {
+				return nil, false
+			}
+		}
+	}
+
+	if len(ps) != len(ss) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+// INFO: sortPatterns orders patterns so that more specific routes are tried first:
+// static segments before dynamic segments before catch-all segments, compared from left to right
+func sortPatterns(patterns []string) {
+	slices.SortStableFunc(patterns, func(a, b string) int {
+		as := PathSegments(a)
+		bs := PathSegments(b)
+
+		for i := 0; i < len(as) && i < len(bs); i++ {
+			ak := segmentKind(as[i])
+			bk := segmentKind(bs[i])
+			if ak != bk {
+				return ak - bk
+			}
+		}
+
+		// INFO: longer patterns are more specific
+		return len(bs) - len(as)
+	})
+}
@@ -0,0 +1,90 @@
+package templating
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    Params
+		ok      bool
+	}{
+		{"/", "/", Params{}, true},
+		{"/", "/posts/", nil, false},
+		{"/posts/", "/posts/", Params{}, true},
+		{"/posts/", "/posts", Params{}, true},
+		{"/posts/", "/post/", nil, false},
+		{"/posts/", "/posts/42/", nil, false},
+		{"/posts/[id]/", "/posts/42/", Params{"id": "42"}, true},
+		{"/posts/[id]/", "/posts/42", Params{"id": "42"}, true},
+		{"/posts/[id]/", "/posts/", nil, false},
+		{"/posts/[id]/", "/posts//", nil, false},
+		{"/posts/[id]/", "/posts/42/edit/", nil, false},
+		{"/posts/[id]/edit/", "/posts/42/edit/", Params{"id": "42"}, true},
+		{"/[lang]/posts/[id]/", "/de/posts/42/", Params{"lang": "de", "id": "42"}, true},
+		{"/docs/[...rest]/", "/docs/a/", Params{"rest": "a"}, true},
+		{"/docs/[...rest]/", "/docs/a/b/c/", Params{"rest": "a/b/c"}, true},
+		{"/docs/[...rest]/", "/docs/a/b/c", Params{"rest": "a/b/c"}, true},
+		{"/docs/[...rest]/", "/docs/", nil, false},
+		{"/docs/[...rest]/", "/blog/a/", nil, false},
+		{"/[...rest]/edit/", "/a/edit/", nil, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := matchPath(tt.pattern, tt.path)
+		if ok != tt.ok {
+			t.Errorf("matchPath(%q, %q) ok = %v, want %v", tt.pattern, tt.path, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSortPatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{
+			"static before dynamic before catch-all",
+			[]string{"/[...rest]/", "/[id]/", "/posts/"},
+			[]string{"/posts/", "/[id]/", "/[...rest]/"},
+		},
+		{
+			"compared from left to right",
+			[]string{"/[lang]/posts/", "/posts/[id]/"},
+			[]string{"/posts/[id]/", "/[lang]/posts/"},
+		},
+		{
+			"longer patterns first",
+			[]string{"/", "/posts/", "/posts/[id]/", "/posts/[id]/edit/"},
+			[]string{"/posts/[id]/edit/", "/posts/[id]/", "/posts/", "/"},
+		},
+		{
+			"catch-all after deeper dynamic routes",
+			[]string{"/docs/[...rest]/", "/docs/[id]/", "/docs/intro/"},
+			[]string{"/docs/intro/", "/docs/[id]/", "/docs/[...rest]/"},
+		},
+		{
+			"trailing slashes do not matter",
+			[]string{"/[id]", "/posts"},
+			[]string{"/posts", "/[id]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := append([]string(nil), tt.patterns...)
+			sortPatterns(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortPatterns(%v) = %v, want %v", tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package templating
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// INFO: name of the query value carrying the token of a preloaded component
+const LIVE_PRELOAD_KEY = "preload"
+
+// INFO: the template rendered in place of a preloaded component while its data loads, e.g. weather_loading
+const LIVE_LOADING_SUFFIX = "_loading"
+
+// INFO: loads taking longer are canceled, their components respond with 504 Gateway Timeout
+const LIVE_PRELOAD_TIMEOUT = 30 * time.Second
+
+// A PreLoadController loads the data of a component that is too slow to block the page render,
+// e.g. a call to another service. The page renders a placeholder right away, see the preload func.
+type PreLoadController interface {
+	// PreLoad returns the dot of the component from the data the preload func was called with.
+	// r is the page request, but its context is not canceled when the page is sent. It is canceled
+	// after LIVE_PRELOAD_TIMEOUT, or if the render of the page fails.
+	PreLoad(r *http.Request, data any) (any, error)
+}
+
+// INFO: a preload is the data of a component loading in the background, until the page fetches it
+type preload struct {
+	name   string
+	t      *template.Template
+	done   chan struct{}
+	cancel context.CancelFunc
+	data   any
+	err    error
+	// INFO: mu serializes the deliveries of a preload, so concurrent fetches deliver it once
+	mu        sync.Mutex
+	delivered bool
+}
+
+// RegisterPreLoad makes a controller available to the preload func under a name.
+//
+// Usage:
+//
+//	{{ preload "weather" . }}
+//
+// starts loading the data of the weather component as soon as the page render gets there and
+// renders the weather_loading template, if there is one, in its place. The loads of a page run
+// concurrently to each other and to the rest of the render. As soon as the page is shown, htmx
+// fetches the weather component rendered with the loaded data and swaps it in.
+func (l *Live) RegisterPreLoad(name string, controller PreLoadController) {
+	l.preloaders.Set(name, controller)
+}
+
+func (l *Live) preload(b *binding, r *http.Request, name string, data any) (template.HTML, error) {
+	controller := l.preloaders.Get(name)
+	if controller == nil {
+		return "", NewError(NoControllerError, name)
+	}
+
+	t := b.t
+	if t.Lookup(name) == nil {
+		return "", NewError(NoTemplateError, name)
+	}
+
+	var placeholder template.HTML
+	if t.Lookup(name+LIVE_LOADING_SUFFIX) != nil {
+		html, err := executeComponent(t, name+LIVE_LOADING_SUFFIX, data)
+		if err != nil {
+			return "", err
+		}
+		placeholder = html
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	// INFO: the load outlives the page request, which ends before the component is fetched
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), LIVE_PRELOAD_TIMEOUT)
+	req := r.WithContext(ctx)
+
+	p := &preload{
+		name:   name,
+		t:      t,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	l.preloads.Set(hex.EncodeToString(id), p)
+
+	b.mu.Lock()
+	b.preloads = append(b.preloads, hex.EncodeToString(id))
+	b.mu.Unlock()
+
+	go func() {
+		defer close(p.done)
+		defer cancel()
+
+		p.data, p.err = controller.PreLoad(req, data)
+		if p.err == nil && ctx.Err() != nil {
+			p.err = ctx.Err()
+		}
+
+		if errors.Is(p.err, context.DeadlineExceeded) {
+			p.err = NewHTTPError(http.StatusGatewayTimeout, NewError(p.err, name))
+		}
+	}()
+
+	src := l.Path + "?" + LIVE_PRELOAD_KEY + "=" + l.sign(hex.EncodeToString(id))
+	return template.HTML(`<div hx-get="` + template.HTMLEscapeString(src) +
+		`" hx-trigger="load" hx-swap="outerHTML">` + string(placeholder) + `</div>`), nil
+}
+
+// INFO: deliver waits for a preload and responds with its component. Every preload is delivered once,
+// concurrent fetches of it wait for the first one. It is kept until the response is written, so
+// clients may retry after a dropped connection.
+func (l *Live) deliver(w http.ResponseWriter, r *http.Request) {
+	id, err := l.unsign(r.URL.Query().Get(LIVE_PRELOAD_KEY))
+	if err != nil {
+		l.fail(w, r, err)
+		return
+	}
+
+	p, ok := l.preloads.Get(id)
+	if !ok {
+		l.fail(w, r, NewHTTPError(http.StatusGone, NewError(NoInstanceError, id)))
+		return
+	}
+
+	select {
+	case <-p.done:
+	case <-r.Context().Done():
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.delivered {
+		l.fail(w, r, NewHTTPError(http.StatusGone, NewError(NoInstanceError, id)))
+		return
+	}
+
+	if p.err != nil {
+		l.fail(w, r, p.err)
+		return
+	}
+
+	html, err := executeComponent(p.t, p.name, p.data)
+	if err != nil {
+		l.fail(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = w.Write([]byte(html))
+	if err != nil {
+		return
+	}
+
+	p.delivered = true
+	l.preloads.Remove(id)
+}
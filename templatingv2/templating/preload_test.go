@@ -0,0 +1,187 @@
+package templating
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var preloadSrc = regexp.MustCompile(`hx-get="([^"]+)"`)
+
+// INFO: testLoader loads "data" once release is closed, or fails with err
+type testLoader struct {
+	release chan struct{}
+	err     error
+	ctx     chan context.Context
+}
+
+func newTestLoader(err error) *testLoader {
+	return &testLoader{release: make(chan struct{}), err: err, ctx: make(chan context.Context, 1)}
+}
+
+func (l *testLoader) PreLoad(r *http.Request, data any) (any, error) {
+	l.ctx <- r.Context()
+
+	select {
+	case <-l.release:
+		return "data", l.err
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+}
+
+func preloadHandler(t *testing.T, loader PreLoadController) (*Handler, *Live) {
+	t.Helper()
+
+	l := NewLive("/_live")
+	l.RegisterPreLoad("slow", loader)
+
+	lr := NewLayoutRegistry(fstest.MapFS{
+		"default/root.tmpl": {Data: []byte(`<html><body>{{ block "body" . }}{{ end }}</body></html>`)},
+	})
+	tr := NewTemplateRegistry(fstest.MapFS{
+		"body.tmpl":                    {Data: []byte(`{{ preload "slow" . }}`)},
+		"components/slow.tmpl":         {Data: []byte(`loaded {{ . }}`)},
+		"components/slow_loading.tmpl": {Data: []byte(`loading`)},
+		"broken/body.tmpl":             {Data: []byte(`{{ preload "slow" . }}{{ preload "missing" . }}`)},
+		"broken/components/slow.tmpl":  {Data: []byte(`loaded {{ . }}`)},
+	})
+	lr.RegisterFuncs(l.Funcs())
+	tr.RegisterFuncs(l.Funcs())
+
+	if err := lr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(lr, tr)
+	h.Live = l
+	return h, l
+}
+
+// INFO: render renders the root page and returns the path its preloaded component is fetched from
+func render(t *testing.T, h *Handler) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "loading") {
+		t.Fatalf("GET /: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	m := preloadSrc.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatalf("GET /: no preload: %s", rec.Body.String())
+	}
+
+	return html.UnescapeString(m[1])
+}
+
+func fetch(l *Live, src string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, src, nil))
+	return rec
+}
+
+func TestPreload(t *testing.T) {
+	loader := newTestLoader(nil)
+	h, l := preloadHandler(t, loader)
+	src := render(t, h)
+
+	ctx := <-loader.ctx
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > LIVE_PRELOAD_TIMEOUT {
+		t.Errorf("load deadline %v, %v, want at most %v", deadline, ok, LIVE_PRELOAD_TIMEOUT)
+	}
+
+	if rec := fetch(l, src+"x"); rec.Code != http.StatusForbidden {
+		t.Errorf("tampered token: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	close(loader.release)
+
+	if rec := fetch(l, src); rec.Code != http.StatusOK || rec.Body.String() != "loaded data" {
+		t.Errorf("first fetch: status %d: %q", rec.Code, rec.Body.String())
+	}
+	if rec := fetch(l, src); rec.Code != http.StatusGone {
+		t.Errorf("second fetch: status %d, want %d", rec.Code, http.StatusGone)
+	}
+}
+
+func TestPreloadDeliversOnce(t *testing.T) {
+	loader := newTestLoader(nil)
+	h, l := preloadHandler(t, loader)
+	src := render(t, h)
+
+	codes := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = fetch(l, src).Code
+		}()
+	}
+
+	close(loader.release)
+	wg.Wait()
+
+	delivered := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			delivered++
+		case http.StatusGone:
+		default:
+			t.Errorf("fetch: status %d", code)
+		}
+	}
+
+	if delivered != 1 {
+		t.Errorf("delivered %d times, want once", delivered)
+	}
+}
+
+func TestPreloadError(t *testing.T) {
+	loader := newTestLoader(errors.New("secret failure"))
+	h, l := preloadHandler(t, loader)
+	src := render(t, h)
+
+	close(loader.release)
+
+	rec := fetch(l, src)
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("failed load: status %d: %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPreloadFailedRender(t *testing.T) {
+	loader := newTestLoader(nil)
+	h, l := preloadHandler(t, loader)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/broken/", nil))
+	if rec.Code == http.StatusOK {
+		t.Fatalf("GET /broken/: status %d", rec.Code)
+	}
+
+	if n := l.preloads.Len(); n != 0 {
+		t.Errorf("failed render kept %d preloads", n)
+	}
+
+	select {
+	case <-(<-loader.ctx).Done():
+	case <-time.After(time.Second):
+		t.Error("the load of a failed render is not canceled")
+	}
+}
@@ -0,0 +1,186 @@
+package templating
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Reload re-parses the routes FS after the given FS paths changed, e.g. as reported by a Watcher.
+// Compiled templates of routes not affected by the changes are carried over to the new route tree.
+// Errors are reported and handled like in Parse.
+func (r *TemplateRegistry) Reload(changed []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.swap(r.parse(r.fresh(), invalidate(changed)))
+}
+
+// Reload re-parses the layouts FS after the given FS paths changed, e.g. as reported by a Watcher.
+// Compiled layouts not affected by the changes, directly or through the layouts they are nested in,
+// are carried over to the new layout tree. Errors are reported and handled like in Parse.
+func (r *LayoutRegistry) Reload(changed []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.swap(r.parse(r.fresh(), invalidate(changed)))
+}
+
+// INFO: fresh returns the current route tree for reuse, unless it was parsed with other funcs or policy
+func (r *TemplateRegistry) fresh() *routeTree {
+	if r.stale.Load() {
+		return nil
+	}
+
+	return r.tree.Load()
+}
+
+// INFO: fresh returns the current layout tree for reuse, unless it was parsed with other funcs or policy
+func (r *LayoutRegistry) fresh() *layoutTree {
+	if r.stale.Load() {
+		return nil
+	}
+
+	return r.tree.Load()
+}
+
+// INFO: a nested layout includes the templates of all its parents
+func (t *layoutTree) affected(name string, inv invalidation) bool {
+	seen := []string{}
+	for name != "" && !slices.Contains(seen, name) {
+		if inv.affects(name) {
+			return true
+		}
+
+		seen = append(seen, name)
+		name = t.layouts[name].Layout
+	}
+
+	return false
+}
+
+// INFO: invalidation maps FS directories to whether the changes in them are inherited by
+// all subdirectories (true), e.g. global components and layout files, or not (false)
+type invalidation map[string]bool
+
+func invalidate(changed []string) invalidation {
+	inv := invalidation{}
+
+	for _, p := range changed {
+		p = filepath.ToSlash(p)
+		base := filepath.Base(p)
+		ext := filepath.Ext(base)
+
+		// INFO: anything that is neither a template nor a layout file is treated as an added or removed directory
+		if base != TEMPLATE_LAYOUT_FILE && !slices.Contains(TEMPLATE_FORMATS, ext) {
+			inv[p] = true
+			continue
+		}
+
+		dir := filepath.ToSlash(filepath.Dir(p))
+
+		// INFO: components belong to the directory containing the components directory,
+		// they are global if any of their subdirectories inside it is
+		global := strings.HasPrefix(base, TEMPLATE_GLOBAL_PREFIX)
+		elems := strings.Split(dir, "/")
+		if i := slices.Index(elems, TEMPLATE_COMPONENT_DIRECTORY); i != -1 {
+			global = isGlobalComponent(strings.Join(append(elems[i+1:], base), "/"))
+			dir = strings.Join(elems[:i], "/")
+			if dir == "" {
+				dir = "."
+			}
+		}
+
+		inv[dir] = inv[dir] || base == TEMPLATE_LAYOUT_FILE || global
+	}
+
+	return inv
+}
+
+// INFO: affects takes a FS directory path, "." being the root directory
+func (inv invalidation) affects(dir string) bool {
+	if _, ok := inv[dir]; ok {
+		return true
+	}
+
+	for dir != "." && dir != "/" && dir != "" {
+		dir = filepath.ToSlash(filepath.Dir(dir))
+		if inv[dir] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reloader tells connected browsers to reload the page, using server sent events.
+// Mount it at Path and set it on the Handler to inject the client script into every page.
+type Reloader struct {
+	Path    string
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func NewReloader(path string) *Reloader {
+	return &Reloader{
+		Path:    path,
+		clients: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Reload notifies all connected browsers
+func (l *Reloader) Reload() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for c := range l.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+			// INFO: a reload is pending for this client anyways
+		}
+	}
+}
+
+func (l *Reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	l.clients[c] = struct{}{}
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		delete(l.clients, c)
+		l.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// Script returns the client script listening for reload events
+func (l *Reloader) Script() string {
+	return `<script>new EventSource("` + l.Path + `").addEventListener("reload", () => location.reload());</script>`
+}
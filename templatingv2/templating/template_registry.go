@@ -1,60 +1,237 @@
 package templating
 
 import (
-	"fmt"
 	"html/template"
 	"io/fs"
+	"log"
+	"maps"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template/parse"
 
 	"github.com/pocketbase/pocketbase/tools/store"
 	"github.com/yalue/merged_fs"
 )
 
+// A Loader provides the data for a route. Its result becomes the dot of the route templates.
+// Return a HTTPError to control the status code of the response.
+type Loader func(r *http.Request, params Params) (any, error)
+
+// INFO: A TemplateRegistry is safe for concurrent use. Parse builds a new routeTree,
+// which is swapped in atomically, so requests always see a fully parsed tree.
 type TemplateRegistry struct {
 	routesFS fs.FS
-	parsed   bool
+	// INFO: mu serializes parsing and guards funcs. Each routeTree holds a copy of the funcs it was parsed with.
+	mu   sync.Mutex
+	tree atomic.Pointer[routeTree]
+	// INFO: stale is set if funcs or the collision policy changed since the tree was parsed
+	stale atomic.Bool
+	funcs template.FuncMap
+	mode  ParseMode
+	// INFO: how templates sharing a name are treated, see SetCollisionPolicy
+	policy CollisionPolicy
+	// INFO: Loader keys are routing paths as well, including [param] segments
+	loaders *store.Store[Loader]
+}
+
+// INFO: A routeTree is never modified after parsing, except for its cache, which is safe for concurrent use
+type routeTree struct {
 	// INFO: Template & cache keys are directory routing paths, with '/' as root
 	templates map[string]TemplateContext
-	cache     *store.Store[*template.Template]
-	funcs     template.FuncMap
+	// INFO: URL paths of route directories containing [param] segments, most specific first
+	dynamic []string
+	// INFO: Errors of broken routes, keyed by routing path
+	broken map[string]error
+	cache  *store.Store[*template.Template]
+	funcs  template.FuncMap
+	// INFO: templates sharing a name, keyed by routing path
+	collisions *store.Store[[]Collision]
 }
 
 func NewTemplateRegistry(routes fs.FS) *TemplateRegistry {
-	return &TemplateRegistry{
-		routesFS:  routes,
-		parsed:    false,
-		templates: make(map[string]TemplateContext),
-		cache:     store.New[*template.Template](nil),
+	registry := &TemplateRegistry{
+		routesFS: routes,
+		loaders:  store.New[Loader](nil),
 		funcs: template.FuncMap{
 			"safe": func(s string) template.HTML {
 				return template.HTML(s)
 			},
 		},
 	}
+
+	// INFO: templates using components must parse, the component funcs are bound on execution
+	maps.Copy(registry.funcs, componentFuncs(nil))
+
+	return registry
 }
 
-// INFO: This returns a new TemplateRegistry with the new fs added to the existing fs,
-// merging with the existing FS, possibly overwriting existing files.
+// Register mounts a routes FS at a URL path, e.g. "/docs/", see MountFS. The mounted routes are
+// part of the route tree like any subdirectory: they inherit the global components and the layout
+// of the directories above the mount point. Files of fs overwrite existing files at the same path.
+// NOTE: This returns a new TemplateRegistry, with the funcs, loaders and parse mode of r.
 func (r *TemplateRegistry) Register(path string, fs fs.FS) *TemplateRegistry {
-	return NewTemplateRegistry(merged_fs.MergeMultiple(fs, r.routesFS))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registry := NewTemplateRegistry(merged_fs.MergeMultiple(MountFS(path, fs), r.routesFS))
+	maps.Copy(registry.funcs, r.funcs)
+	registry.mode = r.mode
+	registry.policy = r.policy
+	registry.loaders.Reset(r.loaders.GetAll())
+
+	return registry
 }
 
+// RegisterFuncs makes funcs available in all route templates. Registering funcs after
+// parsing marks the current route tree as stale, it is parsed again on next use.
 func (r *TemplateRegistry) RegisterFuncs(funcs template.FuncMap) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	for k, v := range funcs {
 		r.funcs[k] = v
 	}
+
+	r.stale.Store(true)
+}
+
+// Funcs returns a copy of the registered funcs
+func (r *TemplateRegistry) Funcs() template.FuncMap {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return maps.Clone(r.funcs)
+}
+
+// Parse reads the routes FS, compiles all routes and replaces the current route tree.
+// Requests in flight keep using the tree they started with. The returned ParseErrors list
+// every broken directory and template. In Strict mode, a broken tree is not used at all,
+// in Lenient mode healthy routes are served and broken routes respond with their error.
+func (r *TemplateRegistry) Parse() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.swap(r.parse(nil, nil))
+}
+
+// INFO: swap stores a parsed tree according to the parse mode. It must be called with mu held.
+func (r *TemplateRegistry) swap(tree *routeTree, err error) error {
+	if err != nil && r.mode == Strict {
+		return err
+	}
+
+	r.tree.Store(tree)
+	r.stale.Store(false)
+	return err
+}
+
+// SetMode sets how Parse, Reload and lazy parsing treat broken templates, the default is Lenient
+func (r *TemplateRegistry) SetMode(mode ParseMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mode = mode
+}
+
+// SetCollisionPolicy sets how Parse and Reload treat templates sharing a name, the default is AllowCollisions.
+// Setting the policy after parsing marks the current route tree as stale, it is parsed again on next use.
+func (r *TemplateRegistry) SetCollisionPolicy(policy CollisionPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.policy = policy
+	r.stale.Store(true)
+}
+
+// Collisions lists the templates of a routing path sharing a name with another template,
+// e.g. a local shadowing a global component. Sources shows the resulting shadowing chains.
+func (r *TemplateRegistry) Collisions(path string) []Collision {
+	tree, err := r.current()
+	if err != nil {
+		return nil
+	}
+
+	return slices.Clone(tree.collisions.Get(path))
+}
+
+// Broken returns the errors of all broken routes of the current route tree, keyed by routing path
+func (r *TemplateRegistry) Broken() map[string]error {
+	tree := r.tree.Load()
+	if tree == nil {
+		return map[string]error{}
+	}
+
+	return maps.Clone(tree.broken)
+}
+
+// INFO: current returns the parsed route tree, parsing it on first use and after it became stale.
+// In Strict mode, a stale tree is kept if parsing it again fails, like on Parse.
+func (r *TemplateRegistry) current() (*routeTree, error) {
+	tree := r.tree.Load()
+	if tree != nil && !r.stale.Load() {
+		return tree, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// INFO: another goroutine might have parsed while we were waiting for the lock
+	tree = r.tree.Load()
+	if tree != nil && !r.stale.Load() {
+		return tree, nil
+	}
+
+	err := r.swap(r.parse(nil, nil))
+	if err != nil && r.mode == Strict {
+		if tree == nil {
+			return nil, err
+		}
+
+		// INFO: we do not parse again on every request, the next Parse or Reload tries again
+		log.Printf("templating: keeping the previous route tree: %v", err)
+		r.stale.Store(false)
+	}
+
+	return r.tree.Load(), nil
 }
 
-func (r *TemplateRegistry) Parse() {
-	// INFO: setting parsed first is important, as it avoids infinite loops in Add() below
-	r.parsed = true
+// INFO: parse always returns a tree, with broken routes recorded in tree.broken. Compiled templates of
+// old are reused for all routes not affected by inv, see Reload. old may be nil to compile everything.
+func (r *TemplateRegistry) parse(old *routeTree, inv invalidation) (*routeTree, error) {
+	tree := &routeTree{
+		templates:  make(map[string]TemplateContext),
+		broken:     make(map[string]error),
+		cache:      store.New[*template.Template](nil),
+		funcs:      maps.Clone(r.funcs),
+		collisions: store.New[[]Collision](nil),
+	}
+
+	errs := ParseErrors{}
+
+	err := fs.WalkDir(r.routesFS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, NewError(FileAccessError, path))
+			if d != nil && d.IsDir() && path != "." {
+				return fs.SkipDir
+			}
+			return nil
+		}
 
-	fs.WalkDir(r.routesFS, ".", func(path string, d fs.DirEntry, err error) error {
 		if !d.IsDir() {
 			return nil
 		}
 
+		// INFO: components directories belong to the route directory containing them, see TemplateContext.Parse
+		if d.Name() == TEMPLATE_COMPONENT_DIRECTORY {
+			return fs.SkipDir
+		}
+
 		url := FSPathToPath(path)
 		tc := NewTemplateContext(url)
 
@@ -63,50 +240,248 @@ func (r *TemplateRegistry) Parse() {
 			pathabove := strings.Join(pathelem[:len(pathelem)-1], string(os.PathSeparator))
 			pathabove = FSPathToPath(pathabove)
 
-			globals, ok := r.templates[pathabove]
+			parent, ok := tree.templates[pathabove]
 			if ok {
-				tc.SetGlobals(globals.GetGlobals())
+				tc.Inherit(parent)
+				tc.Layout = parent.Layout
 			}
 		}
 
-		tc.Parse(r.routesFS)
+		// INFO: broken directories are still part of the tree, so they respond with their error instead of a 404
+		err = tc.Parse(r.routesFS)
+		if err != nil {
+			tree.broken[url] = err
+			errs = append(errs, err)
+		}
+
+		tree.templates[url] = tc
 
-		r.templates[url] = tc
+		if IsDynamicPath(url) {
+			tree.dynamic = append(tree.dynamic, url)
+		}
 
 		return nil
 	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	sortPatterns(tree.dynamic)
+
+	urls := slices.Sorted(maps.Keys(tree.templates))
+	for _, url := range urls {
+		if _, ok := tree.broken[url]; ok {
+			continue
+		}
+
+		if old != nil && !inv.affects(PathToFSPath(url)) {
+			if t := old.cache.Get(url); t != nil {
+				tree.cache.Set(url, t)
+				tree.collisions.Set(url, old.collisions.Get(url))
+				continue
+			}
+		}
+
+		tc := tree.templates[url]
+		t, collisions, err := tc.get(r.routesFS, tree.funcs)
+		if err != nil {
+			tree.broken[url] = err
+			errs = append(errs, err)
+			continue
+		}
+
+		collisions = append(tc.Collisions(), collisions...)
+		tree.collisions.Set(url, collisions)
+
+		err = collide(r.policy, url, collisions)
+		if err != nil {
+			tree.broken[url] = err
+			errs = append(errs, err)
+			continue
+		}
+
+		tree.cache.Set(url, t)
+	}
+
+	if len(errs) > 0 {
+		return tree, errs
+	}
+
+	return tree, nil
+}
+
+// Match resolves a request path to the routing path of a template directory.
+// Static directories are matched exactly, directories named [name] match a single
+// path segment and directories named [...name] match all remaining segments.
+// The captured segment values are returned as Params.
+func (r *TemplateRegistry) Match(path string) (string, Params, error) {
+	tree, err := r.current()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tree.match(path)
+}
+
+func (t *routeTree) match(path string) (string, Params, error) {
+	path = FSPathToPath(PathToFSPath(path))
+
+	if _, ok := t.templates[path]; ok {
+		return path, Params{}, nil
+	}
+
+	for _, pattern := range t.dynamic {
+		if params, ok := matchPath(pattern, path); ok {
+			return pattern, params, nil
+		}
+	}
+
+	return "", nil, NewError(NoTemplateError, path)
 }
 
 // This function takes a template (typically a layout) and adds all the templates of
 // a given directory path to it. This is useful for adding a layout to a template.
+// The path may be a request path, dynamic segments are resolved via Match.
 func (r *TemplateRegistry) Add(path string, t *template.Template) error {
-	temp := r.cache.Get(path)
+	tree, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	return r.add(tree, path, t)
+}
+
+func (r *TemplateRegistry) add(tree *routeTree, path string, t *template.Template) error {
+	path, _, err := tree.match(path)
+	if err != nil {
+		return err
+	}
+
+	if err, ok := tree.broken[path]; ok {
+		return err
+	}
+
+	temp := tree.cache.Get(path)
 	if temp == nil {
-		tc, ok := r.templates[path]
+		tc, ok := tree.templates[path]
 		if !ok {
-			if !r.parsed {
-				r.Parse()
-				return r.Add(path, t)
-			}
 			return NewError(NoTemplateError, path)
 		}
 
-		template, err := tc.Get(r.routesFS)
+		template, err := tc.Get(r.routesFS, tree.funcs)
 		if err != nil {
 			return err
 		}
 
 		// NOTE: we do it like this since using temp above would create a new variable in this scope, not overwrite temp
+		// INFO: concurrent requests might both read the templates here, the last one is cached
 		temp = template
-		r.cache.Set(path, temp)
+		tree.cache.Set(path, temp)
+	}
+
+	// INFO: the route templates are executed as part of t, so t needs the route funcs,
+	// with the component funcs rendering components of t
+	t.Funcs(tree.funcs)
+	t.Funcs(componentFuncs(t))
+
+	for _, st := range temp.Templates() {
+		if st.Tree == nil {
+			continue
+		}
+
+		// INFO: the cached trees are shared between requests. Escaping modifies a tree
+		// on execution, so every template gets its own copy.
+		_, err := t.AddParseTree(st.Name(), st.Tree.Copy())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ErrorRoute returns the routing path of the nearest healthy directory with an error page for the
+// status code, starting at the directory matching path and moving up to the root directory.
+func (r *TemplateRegistry) ErrorRoute(path string, code int) (string, bool) {
+	tree, err := r.current()
+	if err != nil {
+		return "", false
+	}
+
+	return tree.errorRoute(path, code)
+}
+
+func (t *routeTree) errorRoute(path string, code int) (string, bool) {
+	path = FSPathToPath(PathToFSPath(path))
+
+	for {
+		route, _, err := t.match(path)
+		// INFO: the error page of a broken route can not be rendered, so we look further up
+		if _, broken := t.broken[route]; err == nil && !broken {
+			tc := t.templates[route]
+			if _, ok := tc.ErrorTemplate(code); ok {
+				return route, true
+			}
+		}
+
+		if path == "/" {
+			return "", false
+		}
+
+		path = ParentPath(path)
+	}
+}
+
+// AddError adds the templates of a route directory to t, like Add, and the error page for
+// the status code on top. The error page becomes the body template, unless the error page
+// defines templates itself, e.g. {{ define "content" }} for a nested layout.
+func (r *TemplateRegistry) AddError(route string, code int, t *template.Template) error {
+	tree, err := r.current()
+	if err != nil {
+		return err
+	}
+
+	return r.addError(tree, route, code, t)
+}
+
+func (r *TemplateRegistry) addError(tree *routeTree, route string, code int, t *template.Template) error {
+	err := r.add(tree, route, t)
+	if err != nil {
+		return err
 	}
 
+	tc := tree.templates[route]
+	file, ok := tc.ErrorTemplate(code)
+	if !ok {
+		return NewError(NoTemplateError, route)
+	}
+
+	temp := tree.cache.Get(file)
 	if temp == nil {
-		fmt.Println("temp is still nil!")
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		temp, err = readTemplates(r.routesFS, nil, map[string]string{name: file}, tree.funcs, nil)
+		if err != nil {
+			return tc.parseError(err)
+		}
+
+		// INFO: error pages are cached by their FS path, which never collides with a routing path
+		tree.cache.Set(file, temp)
 	}
 
 	for _, st := range temp.Templates() {
-		_, err := t.AddParseTree(st.Name(), st.Tree)
+		if st.Tree == nil {
+			continue
+		}
+
+		name := st.Name()
+		if name == temp.Name() {
+			if temp.Lookup(TEMPLATE_BODY) != nil || (len(temp.Templates()) > 1 && parse.IsEmptyTree(st.Tree.Root)) {
+				continue
+			}
+			name = TEMPLATE_BODY
+		}
+
+		_, err := t.AddParseTree(name, st.Tree.Copy())
 		if err != nil {
 			return err
 		}
@@ -115,7 +490,87 @@ func (r *TemplateRegistry) Add(path string, t *template.Template) error {
 	return nil
 }
 
-// TODO: get for a specific component
-func (r *TemplateRegistry) Get(path string) error {
-	return nil
+// Sources lists the templates of a routing path and the files they are read from
+func (r *TemplateRegistry) Sources(path string) []Source {
+	tree, err := r.current()
+	if err != nil {
+		return nil
+	}
+
+	tc := tree.templates[path]
+	return tc.Sources()
+}
+
+// Layout returns the name of the layout selected for a routing path, or an empty
+// string if no layout file is present in the directory or any of its parents.
+func (r *TemplateRegistry) Layout(path string) string {
+	tree, err := r.current()
+	if err != nil {
+		return ""
+	}
+
+	return tree.templates[path].Layout
+}
+
+// Routes returns the routing paths of all route directories of the current route tree, sorted
+func (r *TemplateRegistry) Routes() []string {
+	tree, err := r.current()
+	if err != nil {
+		return nil
+	}
+
+	return slices.Sorted(maps.Keys(tree.templates))
+}
+
+// HasLoader reports whether a data loader is bound to a routing path, see Load
+func (r *TemplateRegistry) HasLoader(path string) bool {
+	return r.loaders.Get(FSPathToPath(PathToFSPath(path))) != nil
+}
+
+// Load binds a data loader to a routing path, e.g. "/posts/[id]".
+func (r *TemplateRegistry) Load(path string, loader Loader) {
+	r.loaders.Set(FSPathToPath(PathToFSPath(path)), loader)
+}
+
+// Data calls the loader registered for a routing path, as returned by Match.
+// If no loader is registered, the route params are returned as data.
+func (r *TemplateRegistry) Data(req *http.Request, path string, params Params) (any, error) {
+	loader := r.loaders.Get(path)
+	if loader == nil {
+		return params, nil
+	}
+
+	return loader(req, params)
+}
+
+// Get returns the templates of a route directory without a layout, for rendering one of its
+// components on its own. The path may be a request path, like for Add. The component must be
+// a template file of the route, local or inherited, see Sources.
+func (r *TemplateRegistry) Get(path, component string) (*template.Template, error) {
+	tree, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.get(tree, path, component)
+}
+
+func (r *TemplateRegistry) get(tree *routeTree, p, component string) (*template.Template, error) {
+	route, _, err := tree.match(p)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := tree.templates[route]
+	if !tc.Has(component) {
+		return nil, NewError(NoTemplateError, path.Join(route, component))
+	}
+
+	t := template.New(route)
+	err = r.add(tree, route, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
 }
@@ -0,0 +1,242 @@
+package templating
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// INFO: the stress tests are meant to be run with go test -race
+
+const stressWorkers = 8
+const stressRequests = 200
+
+func stressLayouts() fstest.MapFS {
+	return fstest.MapFS{
+		"default/root.tmpl":       {Data: []byte(`<html><body>{{ block "body" . }}{{ end }}</body></html>`)},
+		"default/admin/body.tmpl": {Data: []byte(`<main>{{ block "content" . }}{{ end }}</main>`)},
+	}
+}
+
+func stressRoutes() fstest.MapFS {
+	return fstest.MapFS{
+		"body.tmpl":                  {Data: []byte(`root {{ greet }} {{ template "_card" . }}`)},
+		"components/_card.tmpl":      {Data: []byte(`<div class="card">card</div>`)},
+		"posts/body.tmpl":            {Data: []byte(`posts {{ greet }} {{ template "item" . }}`)},
+		"posts/components/item.tmpl": {Data: []byte(`<li>item</li>`)},
+		"posts/[id]/body.tmpl":       {Data: []byte(`post {{ .id }}`)},
+		"admin/layout":               {Data: []byte(`default/admin`)},
+		"admin/content.tmpl":         {Data: []byte(`admin {{ greet }}`)},
+	}
+}
+
+func stressHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	lr := NewLayoutRegistry(stressLayouts())
+	tr := NewTemplateRegistry(stressRoutes())
+	funcs := template.FuncMap{"greet": func() string { return "hello" }}
+	lr.RegisterFuncs(funcs)
+	tr.RegisterFuncs(funcs)
+
+	if err := lr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewHandler(lr, tr)
+}
+
+// INFO: stress serves the paths from stressWorkers goroutines while mutate runs concurrently,
+// every response must be complete, since requests always see a fully parsed tree
+func stress(t *testing.T, h *Handler, paths map[string]string, mutate ...func(i int)) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressRequests; i++ {
+				for path, want := range paths {
+					rec := httptest.NewRecorder()
+					h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+					if rec.Code != http.StatusOK {
+						t.Errorf("GET %s: status %d: %s", path, rec.Code, rec.Body.String())
+						return
+					}
+					if !strings.Contains(rec.Body.String(), want) {
+						t.Errorf("GET %s: %q does not contain %q", path, rec.Body.String(), want)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for _, m := range mutate {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressRequests; i++ {
+				m(i)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestTemplateRegistryConcurrentReload(t *testing.T) {
+	h := stressHandler(t)
+	changed := [][]string{
+		{"body.tmpl"},
+		{"posts/body.tmpl"},
+		{"components/_card.tmpl"},
+		{"posts/[id]"},
+	}
+
+	stress(t, h, map[string]string{
+		"/":        `root hello <div class="card">card</div>`,
+		"/posts/":  "posts hello <li>item</li>",
+		"/posts/7": "post 7",
+		"/admin/":  "<main>admin hello</main>",
+	}, func(i int) {
+		if err := h.Routes.Reload(changed[i%len(changed)]); err != nil {
+			t.Error(err)
+		}
+	}, func(i int) {
+		if err := h.Routes.Parse(); err != nil {
+			t.Error(err)
+		}
+	}, func(i int) {
+		h.Routes.RegisterFuncs(template.FuncMap{"greet": func() string { return "hello" }})
+	})
+}
+
+func TestTemplateRegistryConcurrentAdd(t *testing.T) {
+	h := stressHandler(t)
+
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < stressRequests; i++ {
+				layout, err := h.Layouts.Get(TEMPLATE_DEFAULT_LAYOUT)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				layout, err = layout.Clone()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if err := h.Routes.Add("/posts/", layout); err != nil {
+					t.Error(err)
+					return
+				}
+
+				var b strings.Builder
+				if err := execute(&b, layout, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestParseErrorContexts(t *testing.T) {
+	tr := NewTemplateRegistry(fstest.MapFS{
+		"body.tmpl":                    {Data: []byte(`root`)},
+		"posts/body.tmpl":              {Data: []byte(`posts`)},
+		"posts/components/_card.tmpl":  {Data: []byte(`{{ if }}`)},
+		"posts/[id]/body.tmpl":         {Data: []byte(`post`)},
+		"posts/[id]/edit/body.tmpl":    {Data: []byte(`{{ end }}`)},
+		"posts/[id]/edit/content.tmpl": {Data: []byte(`content`)},
+	})
+
+	err := tr.Parse()
+	if err == nil {
+		t.Fatal("expected parse errors")
+	}
+
+	want := map[string][]string{
+		"/posts/":           {"/", "/posts/"},
+		"/posts/[id]/":      {"/", "/posts/", "/posts/[id]/"},
+		"/posts/[id]/edit/": {"/", "/posts/", "/posts/[id]/", "/posts/[id]/edit/"},
+	}
+
+	for route, contexts := range want {
+		var perr *ParseError
+		if !errors.As(tr.Broken()[route], &perr) {
+			t.Errorf("%s: expected a ParseError, got %v", route, tr.Broken()[route])
+			continue
+		}
+		if !slices.Equal(perr.Contexts, contexts) {
+			t.Errorf("%s: Contexts = %v, want %v", route, perr.Contexts, contexts)
+		}
+	}
+}
+
+func TestTemplateRegistryStaleTree(t *testing.T) {
+	lr := NewLayoutRegistry(fstest.MapFS{
+		"default/root.tmpl": {Data: []byte(`{{ block "body" . }}{{ end }}`)},
+	})
+	tr := NewTemplateRegistry(fstest.MapFS{
+		"body.tmpl":       {Data: []byte(`{{ greet }}`)},
+		"posts/body.tmpl": {Data: []byte(`posts`)},
+		"posts/a.tmpl":    {Data: []byte(`{{ define "x" }}a{{ end }}`)},
+		"posts/b.tmpl":    {Data: []byte(`{{ define "x" }}b{{ end }}`)},
+	})
+	tr.SetMode(Strict)
+	tr.RegisterFuncs(template.FuncMap{"greet": func() string { return "hello" }})
+
+	if err := tr.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(lr, tr)
+	get := func(path string) string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", path, rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+
+	// INFO: funcs registered after parsing are used once the tree is parsed again
+	tr.RegisterFuncs(template.FuncMap{"greet": func() string { return "hi" }})
+	if body := get("/"); body != "hi" {
+		t.Errorf("GET /: %q, want hi", body)
+	}
+
+	// INFO: a.tmpl and b.tmpl both define x, which is forbidden, in Strict mode the previous tree stays
+	tr.SetCollisionPolicy(ForbidCollisions)
+	if body := get("/posts/"); body != "posts" {
+		t.Errorf("GET /posts/: %q, want posts", body)
+	}
+	if body := get("/"); body != "hi" {
+		t.Errorf("GET /: %q, want hi", body)
+	}
+
+	if err := tr.Parse(); !errors.Is(err, TemplateCollisionError) {
+		t.Errorf("Parse() = %v, want TemplateCollisionError", err)
+	}
+}
@@ -0,0 +1,184 @@
+package templating
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// INFO: Vite 5 writes its manifest to .vite/manifest.json in the build output directory, older versions to manifest.json
+var VITE_MANIFEST_FILES = []string{".vite/manifest.json", "manifest.json"}
+
+const VITE_CLIENT = "@vite/client"
+
+// ViteChunk is an entry of the Vite manifest, see https://vite.dev/guide/backend-integration
+type ViteChunk struct {
+	File           string   `json:"file"`
+	Src            string   `json:"src"`
+	IsEntry        bool     `json:"isEntry"`
+	CSS            []string `json:"css"`
+	Imports        []string `json:"imports"`
+	DynamicImports []string `json:"dynamicImports"`
+}
+
+// Vite resolves the entry points of a Vite build, e.g. "transform/main.js", to the files of the build.
+// In production the manifest of the build is read from the assets FS and the files are served by
+// Assets. With a DevServer, entries are loaded from the Vite dev server instead, including its HMR client.
+type Vite struct {
+	assets *Assets
+	// INFO: URL the browser loads the Vite dev server from, e.g. "http://localhost:5173",
+	// or the path the Proxy is mounted at, e.g. "/_vite". Without a trailing slash.
+	DevServer string
+
+	mu       sync.Mutex
+	manifest map[string]ViteChunk
+}
+
+func NewVite(assets *Assets) *Vite {
+	return &Vite{assets: assets}
+}
+
+// Funcs returns the vite func for templates: {{ vite "transform/main.js" }} renders all script,
+// stylesheet and modulepreload tags for an entry point
+func (v *Vite) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"vite": v.Tags,
+	}
+}
+
+// Reset discards the manifest, it is read again on next use, e.g. after a rebuild in dev builds
+func (v *Vite) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.manifest = nil
+}
+
+// INFO: the manifest is read on first use, so builds without a manifest only fail when it is needed
+func (v *Vite) load() (map[string]ViteChunk, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.manifest != nil {
+		return v.manifest, nil
+	}
+
+	for _, name := range VITE_MANIFEST_FILES {
+		data, err := fs.ReadFile(v.assets.fsys, name)
+		if err != nil {
+			continue
+		}
+
+		manifest := map[string]ViteChunk{}
+		err = json.Unmarshal(data, &manifest)
+		if err != nil {
+			return nil, err
+		}
+
+		v.manifest = manifest
+		return manifest, nil
+	}
+
+	return nil, NewError(FileAccessError, strings.Join(VITE_MANIFEST_FILES, ", "))
+}
+
+// Tags returns the HTML tags loading an entry point
+func (v *Vite) Tags(entry string) (template.HTML, error) {
+	if v.DevServer != "" {
+		return template.HTML(
+			`<script type="module" src="` + template.HTMLEscapeString(v.DevServer+"/"+VITE_CLIENT) + `"></script>` +
+				`<script type="module" src="` + template.HTMLEscapeString(v.DevServer+"/"+entry) + `"></script>`,
+		), nil
+	}
+
+	manifest, err := v.load()
+	if err != nil {
+		return "", err
+	}
+
+	chunk, ok := manifest[entry]
+	if !ok {
+		return "", NewError(NoEntryError, entry)
+	}
+
+	var b strings.Builder
+
+	css := []string{}
+	imports := []string{}
+	v.collect(manifest, entry, &css, &imports, []string{})
+
+	for _, file := range css {
+		u, err := v.assets.URL(file)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(`<link rel="stylesheet" href="` + template.HTMLEscapeString(u) + `" />`)
+	}
+
+	// INFO: Vite lists the file of a CSS entry point as its file only, not in its css
+	if strings.HasSuffix(chunk.File, ".css") {
+		u, err := v.assets.URL(chunk.File)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(`<link rel="stylesheet" href="` + template.HTMLEscapeString(u) + `" />`)
+
+		return template.HTML(b.String()), nil
+	}
+
+	u, err := v.assets.URL(chunk.File)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(`<script type="module" src="` + template.HTMLEscapeString(u) + `"></script>`)
+
+	for _, file := range imports {
+		u, err := v.assets.URL(file)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(`<link rel="modulepreload" href="` + template.HTMLEscapeString(u) + `" />`)
+	}
+
+	return template.HTML(b.String()), nil
+}
+
+// INFO: collect gathers the css of a chunk and all its static imports, and the files of the imports
+func (v *Vite) collect(manifest map[string]ViteChunk, key string, css, imports *[]string, seen []string) {
+	if slices.Contains(seen, key) {
+		return
+	}
+	seen = append(seen, key)
+
+	chunk := manifest[key]
+	for _, file := range chunk.CSS {
+		if !slices.Contains(*css, file) {
+			*css = append(*css, file)
+		}
+	}
+
+	for _, imp := range chunk.Imports {
+		if file := manifest[imp].File; file != "" && !slices.Contains(*imports, file) {
+			*imports = append(*imports, file)
+		}
+		v.collect(manifest, imp, css, imports, seen)
+	}
+}
+
+// Proxy forwards requests to the dev server at upstream, e.g. "http://localhost:5173", so browsers
+// load it from the same origin as the pages, including the HMR websocket. Paths are forwarded as they
+// are, so the dev server must be configured with the path the Proxy is mounted at as its base.
+func (v *Vite) Proxy(upstream string) (http.Handler, error) {
+	u, err := url.Parse(upstream)
+	if err != nil || u.Host == "" {
+		return nil, NewError(InvalidDevServerError, upstream)
+	}
+
+	return httputil.NewSingleHostReverseProxy(u), nil
+}
@@ -0,0 +1,54 @@
+package templating
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestViteTags(t *testing.T) {
+	assets := NewAssets("/assets/", fstest.MapFS{
+		".vite/manifest.json": {Data: []byte(`{
+			"transform/main.js": {"file": "main.js", "src": "transform/main.js", "isEntry": true, "css": ["main.css"], "imports": ["_shared.js"]},
+			"_shared.js": {"file": "shared.js", "css": ["shared.css"]},
+			"transform/site.css": {"file": "site.css", "src": "transform/site.css", "isEntry": true}
+		}`)},
+		"main.js":    {Data: []byte(`main`)},
+		"main.css":   {Data: []byte(`main`)},
+		"shared.js":  {Data: []byte(`shared`)},
+		"shared.css": {Data: []byte(`shared`)},
+		"site.css":   {Data: []byte(`site`)},
+	})
+	vite := NewVite(assets)
+
+	tests := []struct {
+		entry string
+		want  []string
+	}{
+		{"transform/main.js", []string{`rel="stylesheet" href="/assets/main.`, `rel="stylesheet" href="/assets/shared.`, `<script type="module" src="/assets/main.`, `rel="modulepreload" href="/assets/shared.`}},
+		{"transform/site.css", []string{`<link rel="stylesheet" href="/assets/site.`}},
+	}
+
+	for _, tt := range tests {
+		html, err := vite.Tags(tt.entry)
+		if err != nil {
+			t.Fatalf("Tags(%q): %v", tt.entry, err)
+		}
+
+		for _, want := range tt.want {
+			if !strings.Contains(string(html), want) {
+				t.Errorf("Tags(%q) = %s, missing %s", tt.entry, html, want)
+			}
+		}
+	}
+
+	if _, err := vite.Tags("transform/missing.js"); err == nil {
+		t.Error("Tags of a missing entry: expected an error")
+	}
+
+	vite.DevServer = "/_vite"
+	html, err := vite.Tags("transform/main.js")
+	if err != nil || html != `<script type="module" src="/_vite/@vite/client"></script><script type="module" src="/_vite/transform/main.js"></script>` {
+		t.Errorf("Tags with dev server = %s, %v", html, err)
+	}
+}
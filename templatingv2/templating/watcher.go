@@ -0,0 +1,102 @@
+package templating
+
+import (
+	"context"
+	"io/fs"
+	"slices"
+	"time"
+)
+
+// INFO: A Watcher polls a FS for changed files. Polling works with every fs.FS, e.g. the
+// os.DirFS of dev builds, and needs no platform specific notification APIs.
+// Embedded FS never change, since all their modification times are zero.
+type Watcher struct {
+	fsys     fs.FS
+	interval time.Duration
+	stamps   map[string]stamp
+}
+
+type stamp struct {
+	modtime time.Time
+	size    int64
+}
+
+func NewWatcher(fsys fs.FS, interval time.Duration) *Watcher {
+	return &Watcher{
+		fsys:     fsys,
+		interval: interval,
+	}
+}
+
+// Watch blocks until ctx is done, calling onchange with the FS paths of all files and
+// directories that have been added, modified or removed since the last poll.
+func (w *Watcher) Watch(ctx context.Context, onchange func(changed []string)) {
+	w.stamps = w.scan()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stamps := w.scan()
+			changed := diff(w.stamps, stamps)
+			w.stamps = stamps
+
+			if len(changed) > 0 {
+				onchange(changed)
+			}
+		}
+	}
+}
+
+func (w *Watcher) scan() map[string]stamp {
+	stamps := make(map[string]stamp)
+
+	fs.WalkDir(w.fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		// INFO: files might be removed while we walk, we just pick them up on the next poll
+		if err != nil {
+			return nil
+		}
+
+		// INFO: for directories we only track their existence, their modification time changes
+		// with every file created inside, e.g. by editors saving via rename
+		if d.IsDir() {
+			stamps[path] = stamp{}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		stamps[path] = stamp{modtime: info.ModTime(), size: info.Size()}
+
+		return nil
+	})
+
+	return stamps
+}
+
+func diff(before, after map[string]stamp) []string {
+	changed := []string{}
+
+	for path, s := range after {
+		b, ok := before[path]
+		if !ok || !b.modtime.Equal(s.modtime) || b.size != s.size {
+			changed = append(changed, path)
+		}
+	}
+
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+
+	slices.Sort(changed)
+	return changed
+}
@@ -0,0 +1,23 @@
+// Package testthings ships routes and components as an embeddable package. Mount them into
+// a route tree with TemplateRegistry.Register, e.g. at "/things/". The routes use the global
+// components of the route tree they are mounted into, e.g. _globalcomp.
+package testthings
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:routes
+var routes embed.FS
+var RoutesFS = mustSubFS(routes, "routes")
+
+func mustSubFS(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+
+	if err != nil {
+		panic("Could not create SubFS for " + dir)
+	}
+
+	return sub
+}
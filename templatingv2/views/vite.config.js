@@ -1,6 +1,8 @@
 import { resolve } from "path";
 import { defineConfig } from "vite";
-export default defineConfig({
+export default defineConfig(({ command }) => ({
+	// INFO: the dev server is proxied by the Go server at /_vite/, see DEV_VITE_PATH in main_dev.go
+	base: command === "serve" ? "/_vite/" : "/",
 	build: {
 		root: resolve(__dirname, ""),
 		lib: {
@@ -10,5 +12,7 @@ export default defineConfig({
 			formats: ["es"],
 		},
 		outDir: resolve(__dirname, "assets/"),
+		// INFO: the manifest maps entry points to the built files, see templating.Vite
+		manifest: true,
 	},
-});
+}));